@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+	"subscription-service/internal/config"
+)
+
+// runConfig prints the effective configuration even when it is invalid, so
+// that the problems can be seen next to the values causing them.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return fmt.Errorf("config requires the check command")
+	}
+
+	flags := flag.NewFlagSet("config check", flag.ExitOnError)
+	flags.Parse(args[1:])
+
+	cfg, err := config.Read(configPath, configProfile)
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+	os.Stdout.Write(out)
+
+	if err := cfg.Validate(); err != nil {
+		var joined interface{ Unwrap() []error }
+		problems := []error{err}
+		if errors.As(err, &joined) {
+			problems = joined.Unwrap()
+		}
+
+		fmt.Fprintln(os.Stderr, "\ninvalid configuration:")
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, "  "+problem.Error())
+		}
+		return fmt.Errorf("configuration has %d problems", len(problems))
+	}
+
+	fmt.Fprintln(os.Stderr, "\nconfiguration is valid")
+	return nil
+}
@@ -1,64 +1,174 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
 
-	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq"
-	"subscription-service/docs"
+	"github.com/jmoiron/sqlx"
 	"subscription-service/internal/config"
-	"subscription-service/internal/handler"
-	"subscription-service/internal/repository"
-	"subscription-service/internal/service"
+	"subscription-service/internal/logging"
+	"subscription-service/internal/migration"
+	"subscription-service/internal/tenant"
+	"subscription-service/internal/validation"
 	"subscription-service/pkg/database"
-
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
+const usage = `usage: server [--config FILE] [--profile NAME] <command> [flags]
+
+global flags:
+  --config FILE          configuration file, $CONFIG_FILE (default config/config.yaml)
+  --profile NAME         overlay FILE with its profile, e.g. config/config.NAME.yaml, $CONFIG_PROFILE
+
+commands:
+  serve                  start the HTTP server (default)
+  migrate up             apply all pending migrations
+  migrate down [N]       revert the last N migrations
+  migrate to VERSION     migrate up or down to VERSION
+  migrate status         list migrations and whether they are applied
+  seed                   load fixtures
+  import                 import subscriptions from JSON or CSV
+  export                 export subscriptions as JSON or CSV
+  user purge             erase a user and all their data
+  rollup rebuild         recompute the monthly spend rollup
+  config check           validate the configuration and print it with secrets redacted
+
+Run "server <command> -h" for the flags of a command.`
+
 // @title Subscription Service API
 // @version 1.0
 // @description REST API для управления онлайн-подписками пользователей
 // @host localhost:8080
 // @BasePath /api/v1
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT в формате "Bearer <token>"
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
-	cfg, err := config.Load()
+	global := flag.NewFlagSet("server", flag.ExitOnError)
+	global.StringVar(&configPath, "config", os.Getenv("CONFIG_FILE"), "")
+	global.StringVar(&configProfile, "profile", os.Getenv("CONFIG_PROFILE"), "")
+	global.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	// Every command binds requests: serve over HTTP, seed and import from files.
+	if err := validation.Register(); err != nil {
+		slog.Error("failed to register validators", "error", err)
+		os.Exit(1)
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = runServe(args)
+	case "migrate":
+		err = runMigrate(args)
+	case "seed":
+		err = runSeed(args)
+	case "import":
+		err = runImport(args)
+	case "export":
+		err = runExport(args)
+	case "user":
+		err = runUser(args)
+	case "rollup":
+		err = runRollup(args)
+	case "config":
+		err = runConfig(args)
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", command, usage)
+		os.Exit(2)
+	}
+
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		slog.Error(command+" failed", "error", err)
+		os.Exit(1)
 	}
+}
+
+// configPath and configProfile are set by the global flags.
+var configPath, configProfile string
+
+// loadConfig loads the configuration and installs the logger, every command
+// starts with it.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(configPath, configProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	logger, err := logging.New(cfg.Log, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure logging: %w", err)
+	}
+	slog.SetDefault(logger)
+	slog.Info("configuration loaded",
+		"server", cfg.Server.Host+":"+cfg.Server.Port,
+		"database", cfg.Database.User+"@"+cfg.Database.Host+":"+cfg.Database.Port)
+
+	return cfg, nil
+}
+
+// openDatabase connects to Postgres. Commands other than serve work on
+// Postgres only, the memory storage keeps nothing between runs.
+func openDatabase(cfg *config.Config) (*sqlx.DB, *database.Migrator, error) {
+	if cfg.Storage != "postgres" {
+		return nil, nil, fmt.Errorf("command requires postgres storage, configured storage is %q", cfg.Storage)
+	}
+
 	db, err := database.Connect(cfg.Database)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	migrator, err := database.NewMigrator(db, migration.FS)
+	if err != nil {
+		database.Close(db)
+		return nil, nil, fmt.Errorf("failed to load migrations: %w", err)
 	}
-	defer db.Close()
-	if err := database.Migrate(db); err != nil {
-		log.Fatalf("Failed to apply migrations: %v", err)
+
+	return db, migrator, nil
+}
+
+// openSchema connects like openDatabase but refuses to work against a schema
+// with pending migrations, commands other than serve never migrate implicitly.
+func openSchema(ctx context.Context, cfg *config.Config) (*sqlx.DB, error) {
+	db, migrator, err := openDatabase(cfg)
+	if err != nil {
+		return nil, err
 	}
-	subscriptionRepo := repository.NewSubscriptionRepository(db)
-	subscriptionService := service.NewSubscriptionService(subscriptionRepo)
-	subscriptionHandler := handler.NewSubscriptionHandler(subscriptionService)
-	router := gin.Default()
-	docs.SwaggerInfo.BasePath = "/api/v1"
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	api := router.Group("/api/v1")
-	{
-		subscriptions := api.Group("/subscriptions")
-		{
-			subscriptions.POST("", subscriptionHandler.CreateSubscription)
-			subscriptions.GET("", subscriptionHandler.ListSubscriptions)
-			subscriptions.GET("/:id", subscriptionHandler.GetSubscription)
-			subscriptions.PUT("/:id", subscriptionHandler.UpdateSubscription)
-			subscriptions.DELETE("/:id", subscriptionHandler.DeleteSubscription)
-		}
-		api.GET("/summary", subscriptionHandler.GetSummary)
+
+	current, err := migrator.Version(ctx)
+	if err != nil {
+		database.Close(db)
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if current < migrator.Latest() {
+		database.Close(db)
+		return nil, fmt.Errorf("schema is at version %d, expected %d: run \"migrate up\" first", current, migrator.Latest())
 	}
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
 
-	log.Printf("Server starting on port %s", cfg.Server.Port)
-	if err := router.Run(":" + cfg.Server.Port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	return db, nil
+}
+
+// tenantContext is the context of a command acting on behalf of a tenant.
+func tenantContext(id string) (context.Context, error) {
+	if !tenant.ValidID(id) {
+		return nil, fmt.Errorf("invalid tenant id %q", id)
 	}
+	return tenant.WithID(context.Background(), id), nil
 }
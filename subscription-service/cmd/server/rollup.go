@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"subscription-service/internal/repository"
+	"subscription-service/pkg/database"
+)
+
+func runRollup(args []string) error {
+	if len(args) == 0 || args[0] != "rebuild" {
+		return fmt.Errorf("rollup requires the rebuild command")
+	}
+
+	flags := flag.NewFlagSet("rollup rebuild", flag.ExitOnError)
+	flags.Parse(args[1:])
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, err := openSchema(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close(db)
+
+	rows, err := repository.NewRollupRepository(db).RebuildMonthlySpend(ctx)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("monthly spend rollup rebuilt", "rows", rows)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"subscription-service/pkg/database"
+)
+
+//go:embed fixtures/seed.json
+var defaultFixtures []byte
+
+type fixtures struct {
+	Users []struct {
+		model.CreateUserRequest
+		Subscriptions []model.CreateSubscriptionRequest `json:"subscriptions"`
+	} `json:"users"`
+}
+
+// runSeed loads fixtures through the services. Users that already exist are
+// skipped together with their subscriptions, so seeding twice is harmless.
+func runSeed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	tenantID := flags.String("tenant", "default", "tenant to seed")
+	file := flags.String("file", "", "fixtures file, the built-in fixtures are used when empty")
+	flags.Parse(args)
+
+	data := defaultFixtures
+	if *file != "" {
+		var err error
+		if data, err = os.ReadFile(*file); err != nil {
+			return fmt.Errorf("failed to read fixtures: %w", err)
+		}
+	}
+
+	var fx fixtures
+	if err := json.Unmarshal(data, &fx); err != nil {
+		return fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+
+	ctx, err := tenantContext(*tenantID)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := openSchema(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close(db)
+
+	userRepo := repository.NewUserRepository(db)
+	userService := service.NewUserService(userRepo)
+	subscriptionService := service.NewSubscriptionService(repository.NewSubscriptionRepository(db), userRepo)
+
+	var users, subscriptions int
+	for i, u := range fx.Users {
+		if u.ID == nil {
+			return fmt.Errorf("fixture user #%d has no id", i+1)
+		}
+		if err := validate(&u.CreateUserRequest); err != nil {
+			return fmt.Errorf("invalid fixture user %s: %w", *u.ID, err)
+		}
+
+		exists, err := userRepo.Exists(ctx, *u.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			slog.Info("user already exists, skipping", "user_id", *u.ID)
+			continue
+		}
+
+		if _, err := userService.CreateUser(ctx, &u.CreateUserRequest); err != nil {
+			return fmt.Errorf("failed to create user %s: %w", *u.ID, err)
+		}
+		users++
+
+		for _, req := range u.Subscriptions {
+			req.UserID = *u.ID
+			if err := validate(&req); err != nil {
+				return fmt.Errorf("invalid fixture subscription of user %s: %w", *u.ID, err)
+			}
+			if _, err := subscriptionService.CreateSubscription(ctx, &req); err != nil {
+				return fmt.Errorf("failed to create subscription of user %s: %w", *u.ID, err)
+			}
+			subscriptions++
+		}
+	}
+
+	slog.Info("fixtures loaded", "tenant_id", *tenantID, "users", users, "subscriptions", subscriptions)
+	return nil
+}
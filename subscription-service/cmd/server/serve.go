@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"subscription-service/docs"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/certs"
+	"subscription-service/internal/config"
+	"subscription-service/internal/cors"
+	"subscription-service/internal/event"
+	"subscription-service/internal/handler"
+	"subscription-service/internal/health"
+	"subscription-service/internal/logging"
+	"subscription-service/internal/metrics"
+	"subscription-service/internal/ratelimit"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"subscription-service/internal/tenant"
+	"subscription-service/internal/tracing"
+	"subscription-service/pkg/database"
+
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// runServe starts the HTTP server together with the background workers and
+// blocks until SIGINT or SIGTERM.
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Parse(args)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to configure tracing: %w", err)
+	}
+
+	store, err := openStorage(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+	// Workers get their own context: on shutdown they are stopped while the
+	// HTTP server is still draining requests that may enqueue events.
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+
+	subscriptionService := service.NewSubscriptionService(store.subscriptions, store.users)
+	if cfg.SummaryCache.Enabled {
+		cache := service.NewSummaryCache(cfg.SummaryCache.TTL, cfg.SummaryCache.MaxEntries)
+		subscriptionService = service.NewCachedSubscriptionService(subscriptionService, cache)
+		// Other replicas and commands write to the same database.
+		if store.db != nil {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				err := database.Listen(workersCtx, cfg.Database, service.SummaryInvalidationChannel, cache.InvalidateNotification, cache.Reset)
+				if err != nil {
+					slog.Error("summary cache invalidation stopped, falling back to the TTL", "error", err)
+				}
+			}()
+		}
+		slog.Info("summary cache enabled", "ttl", cfg.SummaryCache.TTL, "max_entries", cfg.SummaryCache.MaxEntries)
+	}
+	userService := service.NewUserService(store.users)
+	subscriptionHandler := handler.NewSubscriptionHandler(subscriptionService)
+	userHandler := handler.NewUserHandler(userService)
+
+	// Webhooks, API keys, tenants and events need Postgres.
+	var (
+		apiKeys        auth.APIKeyVerifier
+		webhookHandler *handler.WebhookHandler
+		apiKeyHandler  *handler.APIKeyHandler
+		tenantHandler  *handler.TenantHandler
+		workerChecks   = map[string]health.Check{}
+	)
+	if store.db != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			store.router.Run(workersCtx, cfg.Database.ReplicaCheckInterval)
+		}()
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			store.router.MonitorPools(workersCtx, cfg.Database.PoolCheckInterval)
+		}()
+
+		webhookRepo := repository.NewWebhookRepository(store.db)
+		apiKeyService := service.NewAPIKeyService(repository.NewAPIKeyRepository(store.db), cfg.Auth.APIKeyRotationGrace)
+		webhookService := service.NewWebhookService(webhookRepo)
+		apiKeys = apiKeyService
+		webhookHandler = handler.NewWebhookHandler(webhookService)
+		apiKeyHandler = handler.NewAPIKeyHandler(apiKeyService)
+		tenantHandler = handler.NewTenantHandler(service.NewTenantService(repository.NewTenantRepository(store.db)))
+
+		deliveryWorker := service.NewDeliveryWorker(webhookRepo, cfg.Webhooks)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			deliveryWorker.Run(workersCtx)
+		}()
+		workerChecks["webhook_delivery_worker"] = deliveryWorker.Health(cfg.Health.WorkerStaleAfter)
+
+		publisher, closePublisher, err := newEventPublisher(cfg.Events, webhookService)
+		if err != nil {
+			return fmt.Errorf("failed to configure event publishers: %w", err)
+		}
+		defer closePublisher()
+		outboxRelay := service.NewOutboxRelay(repository.NewOutboxRepository(store.db), publisher, cfg.Events)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			outboxRelay.Run(workersCtx)
+		}()
+		workerChecks["outbox_relay"] = outboxRelay.Health(cfg.Health.WorkerStaleAfter)
+	}
+
+	router := gin.New()
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/metrics" && r.URL.Path != "/livez" && r.URL.Path != "/readyz"
+	})))
+	router.Use(logging.RequestID(), logging.AccessLog(), metrics.Middleware(), logging.Recovery())
+	if len(cfg.Server.CORS.AllowedOrigins) > 0 {
+		router.Use(cors.Middleware(cfg.Server.CORS))
+	}
+	docs.SwaggerInfo.BasePath = "/api/v1"
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	rateLimit, ipRateLimit, err := newRateLimit(cfg.RateLimit, store.db)
+	if err != nil {
+		return fmt.Errorf("failed to configure rate limiting: %w", err)
+	}
+
+	// The per-IP limit comes before authentication, so that floods of invalid
+	// credentials are limited as well.
+	api := router.Group("/api/v1", ipRateLimit)
+	var authenticator *auth.Authenticator
+	if cfg.Auth.Enabled {
+		authenticator, err = auth.NewAuthenticator(cfg.Auth, apiKeys)
+		if err != nil {
+			return fmt.Errorf("failed to configure authentication: %w", err)
+		}
+		api.Use(authenticator.Middleware())
+	} else {
+		slog.Warn("authentication is disabled, all routes are public")
+	}
+	api.Use(tenant.Middleware())
+	if len(cfg.Database.Replicas) > 0 && store.db != nil {
+		api.Use(handler.ReadYourWrites(cfg.Database.ReadYourWritesWindow))
+	}
+
+	{
+		subscriptionsRead := api.Group("/subscriptions", auth.RequireScope(auth.ScopeSubscriptionsRead), rateLimit("read", cfg.RateLimit.Read))
+		{
+			subscriptionsRead.GET("", subscriptionHandler.ListSubscriptions)
+			subscriptionsRead.GET("/:id", subscriptionHandler.GetSubscription)
+		}
+		subscriptionsWrite := api.Group("/subscriptions", auth.RequireScope(auth.ScopeSubscriptionsWrite), rateLimit("write", cfg.RateLimit.Write))
+		{
+			subscriptionsWrite.POST("", subscriptionHandler.CreateSubscription)
+			subscriptionsWrite.PUT("/:id", subscriptionHandler.UpdateSubscription)
+			subscriptionsWrite.DELETE("/:id", subscriptionHandler.DeleteSubscription)
+		}
+		summary := api.Group("/summary", auth.RequireScope(auth.ScopeSummaryRead), rateLimit("summary", cfg.RateLimit.Summary))
+		{
+			summary.GET("", subscriptionHandler.GetSummary)
+		}
+
+		users := api.Group("/users", auth.RequireAdmin(), rateLimit("admin", cfg.RateLimit.Admin))
+		{
+			users.POST("", userHandler.CreateUser)
+			users.GET("", userHandler.ListUsers)
+			users.GET("/:id", userHandler.GetUser)
+			users.PUT("/:id", userHandler.UpdateUser)
+			users.DELETE("/:id", userHandler.DeleteUser)
+		}
+
+		if store.db != nil {
+			webhooks := api.Group("/webhooks", auth.RequireAdmin(), rateLimit("admin", cfg.RateLimit.Admin))
+			{
+				webhooks.POST("", webhookHandler.CreateWebhook)
+				webhooks.GET("", webhookHandler.ListWebhooks)
+				webhooks.GET("/:id", webhookHandler.GetWebhook)
+				webhooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+				webhooks.GET("/:id/deliveries", webhookHandler.ListDeliveries)
+				webhooks.POST("/:id/deliveries/:delivery_id/replay", webhookHandler.ReplayDelivery)
+			}
+
+			apiKeys := api.Group("/admin/api-keys", auth.RequireAdmin(), rateLimit("admin", cfg.RateLimit.Admin))
+			{
+				apiKeys.POST("", apiKeyHandler.IssueAPIKey)
+				apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+				apiKeys.POST("/:id/rotate", apiKeyHandler.RotateAPIKey)
+				apiKeys.DELETE("/:id", apiKeyHandler.RevokeAPIKey)
+			}
+
+			tenants := api.Group("/admin/tenants", auth.RequirePlatformAdmin(), rateLimit("admin", cfg.RateLimit.Admin))
+			{
+				tenants.POST("", tenantHandler.CreateTenant)
+				tenants.GET("", tenantHandler.ListTenants)
+			}
+		}
+	}
+	prometheus.MustRegister(metrics.NewSubscriptionCollector(store.subscriptions))
+	if store.db != nil {
+		prometheus.MustRegister(collectors.NewDBStatsCollector(store.db.DB, cfg.Database.Name))
+	}
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	checker := newHealthChecker(cfg.Health, store.db, store.migrator, authenticator)
+	for name, check := range workerChecks {
+		checker.Add(name, check)
+	}
+	router.GET("/livez", checker.Livez)
+	router.GET("/readyz", checker.Readyz)
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	tlsEnabled := cfg.Server.TLS.CertFile != "" || cfg.Server.TLS.KeyFile != ""
+	if tlsEnabled {
+		reloader, err := certs.NewReloader(cfg.Server.TLS)
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		server.TLSConfig = reloader.ServerConfig()
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			reloader.Run(workersCtx, cfg.Server.TLS.ReloadInterval)
+		}()
+	}
+
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("server starting", "port", cfg.Server.Port, "tls", tlsEnabled)
+		var err error
+		if tlsEnabled {
+			// The certificate comes from server.TLSConfig.
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("failed to start server: %w", err)
+	case <-signalCtx.Done():
+		slog.Info("shutdown signal received, draining", "timeout", cfg.Server.ShutdownTimeout)
+	}
+
+	// Requests keep being served while load balancers notice the failing
+	// /readyz and stop routing new ones here.
+	checker.Drain()
+	if cfg.Server.DrainDelay > 0 {
+		slog.Info("waiting for load balancers to stop routing requests", "drain_delay", cfg.Server.DrainDelay)
+		time.Sleep(cfg.Server.DrainDelay)
+	}
+	stopWorkers()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("error draining HTTP requests", "error", err)
+	}
+
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		slog.Warn("background workers did not stop before the shutdown timeout")
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("error flushing traces", "error", err)
+	}
+
+	slog.Info("server stopped")
+	return nil
+}
+
+// newHealthChecker registers the database checks, if there is a database.
+// With details_require_auth the detailed report is only shown to callers the
+// authenticator accepts.
+func newHealthChecker(cfg config.HealthConfig, db *sqlx.DB, migrator *database.Migrator, authenticator *auth.Authenticator) *health.Checker {
+	var authorize func(r *http.Request) bool
+	if cfg.DetailsRequireAuth {
+		authorize = func(r *http.Request) bool {
+			if authenticator == nil {
+				return false
+			}
+			_, err := authenticator.Authenticate(r)
+			return err == nil
+		}
+	}
+
+	checker := health.NewChecker(cfg.CheckTimeout, authorize)
+	if db == nil {
+		return checker
+	}
+	checker.Add("database", func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+	checker.Add("migrations", func(ctx context.Context) error {
+		current, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		// A newer schema is fine, it is applied by the next release during
+		// a rolling deploy.
+		if current < migrator.Latest() {
+			return fmt.Errorf("schema version %d, expected %d", current, migrator.Latest())
+		}
+		return nil
+	})
+
+	return checker
+}
+
+// newRateLimit returns the middleware limiting a route group per client and
+// the one limiting all routes per IP address.
+func newRateLimit(cfg config.RateLimitConfig, db *sqlx.DB) (func(group string, rule config.RateLimitRule) gin.HandlerFunc, gin.HandlerFunc, error) {
+	if !cfg.Enabled {
+		next := func(c *gin.Context) { c.Next() }
+		return func(string, config.RateLimitRule) gin.HandlerFunc { return next }, next, nil
+	}
+
+	var limiter ratelimit.Limiter
+	switch cfg.Backend {
+	case "memory":
+		limiter = ratelimit.NewMemoryLimiter(cfg.IdleTTL)
+	case "postgres":
+		if db == nil {
+			return nil, nil, fmt.Errorf("postgres rate limit backend requires postgres storage")
+		}
+		limiter = ratelimit.NewPostgresLimiter(db, cfg.IdleTTL)
+	default:
+		return nil, nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+	}
+
+	slog.Info("rate limiting enabled", "backend", cfg.Backend)
+	rateLimit := func(group string, rule config.RateLimitRule) gin.HandlerFunc {
+		return ratelimit.Middleware(limiter, group, ratelimit.Limit{Rate: rule.Rate, Burst: rule.Burst})
+	}
+	ipRateLimit := ratelimit.ByIP(limiter, "ip", ratelimit.Limit{Rate: cfg.IP.Rate, Burst: cfg.IP.Burst})
+	return rateLimit, ipRateLimit, nil
+}
+
+func newEventPublisher(cfg config.EventsConfig, webhooks event.EventPublisher) (event.EventPublisher, func(), error) {
+	var publishers []event.EventPublisher
+	var closers []io.Closer
+
+	closeAll := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+
+	for _, name := range cfg.Publishers {
+		switch name {
+		case "webhook":
+			publishers = append(publishers, webhooks)
+		case "stdout":
+			publishers = append(publishers, event.NewStdoutPublisher())
+		case "file":
+			publisher, closer, err := event.NewFilePublisher(cfg.FilePath)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			publishers = append(publishers, publisher)
+			closers = append(closers, closer)
+		case "http":
+			if cfg.HTTPURL == "" {
+				closeAll()
+				return nil, nil, fmt.Errorf("http publisher requires events.http_url")
+			}
+			publishers = append(publishers, event.NewHTTPPublisher(cfg.HTTPURL, cfg.HTTPTimeout))
+		default:
+			closeAll()
+			return nil, nil, fmt.Errorf("unknown event publisher %q", name)
+		}
+	}
+
+	return event.NewMultiPublisher(publishers...), closeAll, nil
+}
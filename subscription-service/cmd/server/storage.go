@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+	"subscription-service/internal/config"
+	"subscription-service/internal/repository"
+	"subscription-service/pkg/database"
+)
+
+// storage holds the repositories of the configured storage. Webhooks, API
+// keys, tenants and the outbox only exist in Postgres, db, router and
+// migrator are nil for the other storages.
+type storage struct {
+	db            *sqlx.DB
+	router        *database.Router
+	migrator      *database.Migrator
+	subscriptions repository.SubscriptionRepository
+	users         repository.UserRepository
+	close         func()
+}
+
+// openStorage opens the storage serve works with, Postgres is migrated up
+// first.
+func openStorage(ctx context.Context, cfg *config.Config) (*storage, error) {
+	switch cfg.Storage {
+	case "postgres":
+		db, migrator, err := openDatabase(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := migrator.Up(ctx); err != nil {
+			database.Close(db)
+			return nil, fmt.Errorf("failed to apply migrations: %w", err)
+		}
+		router, err := database.NewRouter(db, cfg.Database)
+		if err != nil {
+			database.Close(db)
+			return nil, fmt.Errorf("failed to open database replicas: %w", err)
+		}
+		return &storage{
+			db:            db,
+			router:        router,
+			migrator:      migrator,
+			subscriptions: repository.NewReplicatedSubscriptionRepository(router),
+			users:         repository.NewUserRepository(db),
+			close: func() {
+				router.Close()
+				database.Close(db)
+			},
+		}, nil
+	case "memory":
+		slog.Warn("using in-memory storage, data is lost on restart")
+		store := repository.NewMemoryStore()
+		return &storage{
+			subscriptions: repository.NewMemorySubscriptionRepository(store),
+			users:         repository.NewMemoryUserRepository(store),
+			close:         func() {},
+		}, nil
+	case "file":
+		store, err := repository.OpenFileStore(cfg.FileStorage.Path, cfg.FileStorage.CompactInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file storage: %w", err)
+		}
+		slog.Info("using file storage", "path", cfg.FileStorage.Path)
+		return &storage{
+			subscriptions: repository.NewMemorySubscriptionRepository(store.MemoryStore),
+			users:         repository.NewMemoryUserRepository(store.MemoryStore),
+			close: func() {
+				if err := store.Close(); err != nil {
+					slog.Error("error closing file storage", "error", err)
+				}
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"subscription-service/internal/validation"
+	"subscription-service/pkg/database"
+)
+
+// csvHeader is the column layout written by export. Import looks columns up
+// by name, so only user_id, service_name, price and start_date are required.
+var csvHeader = []string{"id", "user_id", "service_name", "price", "start_date", "end_date", "created_at", "updated_at"}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	tenantID := flags.String("tenant", "default", "tenant to export")
+	format := flags.String("format", "json", "output format, json or csv")
+	out := flags.String("out", "", "output file, stdout when empty")
+	userID := flags.String("user", "", "export only the subscriptions of this user")
+	serviceName := flags.String("service", "", "export only the subscriptions of this service")
+	flags.Parse(args)
+
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unsupported format %q", *format)
+	}
+
+	ctx, err := tenantContext(*tenantID)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := openSchema(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close(db)
+
+	// Exports are read from a replica when there is one.
+	router, err := database.NewRouter(db, cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open database replicas: %w", err)
+	}
+	defer router.Close()
+
+	subscriptionService := service.NewSubscriptionService(repository.NewReplicatedSubscriptionRepository(router), repository.NewUserRepository(db))
+	subscriptions, err := subscriptionService.ListSubscriptions(ctx, optional(*userID), optional(*serviceName))
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "csv" {
+		err = writeCSV(w, subscriptions)
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(subscriptions)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write subscriptions: %w", err)
+	}
+
+	slog.Info("subscriptions exported", "tenant_id", *tenantID, "count", len(subscriptions))
+	return nil
+}
+
+// runImport creates subscriptions through the service, so users have to exist
+// and every imported subscription gets a new id. All rows are validated
+// before the first one is written.
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	tenantID := flags.String("tenant", "default", "tenant to import into")
+	format := flags.String("format", "json", "input format, json or csv")
+	in := flags.String("in", "", "input file, stdin when empty")
+	dryRun := flags.Bool("dry-run", false, "only validate the input, without checking that the users exist")
+	flags.Parse(args)
+
+	r := io.Reader(os.Stdin)
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return fmt.Errorf("failed to open input file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var (
+		requests []*model.CreateSubscriptionRequest
+		err      error
+	)
+	switch *format {
+	case "json":
+		err = json.NewDecoder(r).Decode(&requests)
+	case "csv":
+		requests, err = readCSV(r)
+	default:
+		return fmt.Errorf("unsupported format %q", *format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read subscriptions: %w", err)
+	}
+
+	for i, req := range requests {
+		if err := validate(req); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	if *dryRun {
+		slog.Info("input is valid", "count", len(requests))
+		return nil
+	}
+
+	ctx, err := tenantContext(*tenantID)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := openSchema(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close(db)
+
+	// All rows are imported in one transaction, so that a failed import can
+	// be fixed and run again without duplicating the rows before the failure.
+	subscriptionService := service.NewSubscriptionService(repository.NewSubscriptionRepository(db), repository.NewUserRepository(db))
+	if _, err := subscriptionService.ImportSubscriptions(ctx, requests); err != nil {
+		return fmt.Errorf("nothing imported: %w", err)
+	}
+
+	slog.Info("subscriptions imported", "tenant_id", *tenantID, "count", len(requests))
+	return nil
+}
+
+func writeCSV(w io.Writer, subscriptions []*model.Subscription) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, s := range subscriptions {
+		err := cw.Write([]string{
+			s.ID,
+			s.UserID,
+			s.ServiceName,
+			strconv.Itoa(s.Price),
+			s.StartDate,
+			deref(s.EndDate),
+			s.CreatedAt.Format(time.RFC3339),
+			s.UpdatedAt.Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func readCSV(r io.Reader) ([]*model.CreateSubscriptionRequest, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"user_id", "service_name", "price", "start_date"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var requests []*model.CreateSubscriptionRequest
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return requests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		price, err := strconv.Atoi(record[columns["price"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid price %q", line, record[columns["price"]])
+		}
+
+		req := &model.CreateSubscriptionRequest{
+			UserID:      record[columns["user_id"]],
+			ServiceName: record[columns["service_name"]],
+			Price:       price,
+			StartDate:   record[columns["start_date"]],
+		}
+		if i, ok := columns["end_date"]; ok && record[i] != "" {
+			req.EndDate = &record[i]
+		}
+		requests = append(requests, req)
+	}
+}
+
+// validate runs the binding validation of the HTTP API on obj and lists the
+// offending fields in the error.
+func validate(obj any) error {
+	err := binding.Validator.ValidateStruct(obj)
+	fields, ok := validation.Fields(err)
+	if !ok {
+		return err
+	}
+
+	problems := make([]string, 0, len(fields))
+	for _, f := range fields {
+		problems = append(problems, f.Field+" "+f.Message)
+	}
+	return errors.New(strings.Join(problems, ", "))
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
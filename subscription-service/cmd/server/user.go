@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"subscription-service/pkg/database"
+)
+
+func runUser(args []string) error {
+	if len(args) == 0 || args[0] != "purge" {
+		return fmt.Errorf("user requires the purge command")
+	}
+
+	flags := flag.NewFlagSet("user purge", flag.ExitOnError)
+	tenantID := flags.String("tenant", "default", "tenant of the user")
+	id := flags.String("id", "", "id of the user to purge")
+	confirm := flags.Bool("yes", false, "confirm that the user and all their data should be erased")
+	flags.Parse(args[1:])
+
+	if *id == "" {
+		return fmt.Errorf("-id is required")
+	}
+	if !*confirm {
+		return fmt.Errorf("purging is irreversible, pass -yes to confirm")
+	}
+
+	ctx, err := tenantContext(*tenantID)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := openSchema(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close(db)
+
+	return service.NewUserService(repository.NewUserRepository(db)).PurgeUser(ctx, *id)
+}
@@ -0,0 +1,6 @@
+-- The service connects as app instead of postgres: superusers bypass
+-- row-level security. Owning the database, and with it the public schema,
+-- lets app run the migrations; FORCE ROW LEVEL SECURITY makes the policies
+-- apply to the tables it owns.
+CREATE ROLE app LOGIN PASSWORD 'app_password' NOSUPERUSER NOBYPASSRLS NOCREATEDB NOCREATEROLE;
+ALTER DATABASE subscriptions OWNER TO app;
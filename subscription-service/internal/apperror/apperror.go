@@ -0,0 +1,81 @@
+// Package apperror defines the domain errors shared by the repository and
+// service layers. Handlers map them to HTTP statuses, everything else is an
+// internal error.
+package apperror
+
+import "errors"
+
+// Kinds of domain errors, match them with errors.Is.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrValidation         = errors.New("validation failed")
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+// Error is a domain error with a stable machine readable code, e.g.
+// "subscription_not_found". Message is safe to show to API clients, the
+// wrapped cause is only meant for logs.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError points at the offending input of a validation error. Field is
+// the name of the JSON field or query parameter.
+type FieldError struct {
+	Field   string `json:"field" example:"end_date"`
+	Code    string `json:"code" example:"end_before_start"`
+	Message string `json:"message" example:"must not be before start_date"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+func New(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func Wrap(kind error, code, message string, err error) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Err: err}
+}
+
+func NotFound(code, message string) *Error {
+	return New(ErrNotFound, code, message)
+}
+
+func Validation(code, message string) *Error {
+	return New(ErrValidation, code, message)
+}
+
+// InvalidFields is a validation error listing every offending field.
+func InvalidFields(fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: "validation_failed", Message: "request is invalid", Fields: fields}
+}
+
+func Conflict(code, message string) *Error {
+	return New(ErrConflict, code, message)
+}
+
+func PreconditionFailed(code, message string) *Error {
+	return New(ErrPreconditionFailed, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return New(ErrForbidden, code, message)
+}
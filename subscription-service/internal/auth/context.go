@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+)
+
+const (
+	ScopeSubscriptionsRead  = "subscriptions:read"
+	ScopeSubscriptionsWrite = "subscriptions:write"
+	ScopeSummaryRead        = "summary:read"
+	ScopeAdmin              = "admin"
+)
+
+// Principal is the authenticated caller of a request: either a user with a
+// JWT or a service with an API key. Only API keys carry scopes, users are
+// limited by data ownership instead.
+type Principal struct {
+	Subject  string
+	Roles    []string
+	Admin    bool
+	APIKeyID string
+	Scopes   []string
+	// TenantID is empty for platform operators that may act on any tenant.
+	TenantID string
+}
+
+func (p *Principal) IsAPIKey() bool {
+	return p.APIKeyID != ""
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if !p.IsAPIKey() || p.Admin {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the caller stored by the auth middleware. There
+// is no principal when authentication is disabled or for internal callers.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// IsPlatformAdmin reports whether the caller administers the whole
+// deployment rather than a single tenant.
+func (p *Principal) IsPlatformAdmin() bool {
+	return p.Admin && p.TenantID == ""
+}
+
+// RestrictedUserID returns the user whose data the caller is limited to.
+// Admins, API keys and unauthenticated internal callers are not restricted.
+func RestrictedUserID(ctx context.Context) (string, bool) {
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok || principal.Admin || principal.IsAPIKey() {
+		return "", false
+	}
+	return principal.Subject, true
+}
@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRefetchInterval protects the JWKS endpoint from being hammered by
+// tokens carrying unknown key IDs.
+const minRefetchInterval = time.Minute
+
+// A failed refresh is retried after refreshRetry, doubled with every further
+// failure up to maxRefreshRetry, so that an outage of the endpoint does not
+// turn every request into a fetch.
+const (
+	refreshRetry    = 5 * time.Second
+	maxRefreshRetry = 5 * time.Minute
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// KeySet holds the public keys used to verify token signatures. Keys loaded
+// from a URL are refreshed after refreshInterval or when a token references
+// an unknown key ID. Stale keys keep being served while a refresh runs in
+// the background and after it fails, only unknown key IDs wait for one.
+type KeySet struct {
+	file            string
+	url             string
+	refreshInterval time.Duration
+	client          *http.Client
+
+	// refreshing allows one refresh at a time.
+	refreshing sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	failures    int
+	retryAt     time.Time
+}
+
+func NewFileKeySet(path string) (*KeySet, error) {
+	ks := &KeySet{file: path}
+	if err := ks.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func NewURLKeySet(url string, refreshInterval time.Duration) (*KeySet, error) {
+	ks := &KeySet{
+		url:             url,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := ks.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	key, ok := ks.lookup(kid)
+	stale, canRefetch := ks.due(time.Now())
+	ks.mu.RUnlock()
+
+	if ok {
+		if stale {
+			go ks.refreshInBackground()
+		}
+		return key, nil
+	}
+
+	if stale || canRefetch {
+		if err := ks.refreshForKey(ctx, kid); err != nil {
+			return nil, err
+		}
+		ks.mu.RLock()
+		key, ok = ks.lookup(kid)
+		ks.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// due reports whether the keys are stale and whether an unknown key ID may
+// trigger a refresh at now. Neither holds while a failed refresh backs off.
+// It must be called with mu held.
+func (ks *KeySet) due(now time.Time) (stale, canRefetch bool) {
+	if ks.url == "" || now.Before(ks.retryAt) {
+		return false, false
+	}
+	return now.Sub(ks.fetchedAt) > ks.refreshInterval, now.Sub(ks.attemptedAt) > minRefetchInterval
+}
+
+// refreshForKey refreshes the keys for the unknown key ID kid once the
+// refresh already running, if any, is done. That refresh may have brought
+// the key or failed just now, it is not repeated then.
+func (ks *KeySet) refreshForKey(ctx context.Context, kid string) error {
+	ks.refreshing.Lock()
+	defer ks.refreshing.Unlock()
+
+	ks.mu.RLock()
+	_, ok := ks.lookup(kid)
+	stale, canRefetch := ks.due(time.Now())
+	ks.mu.RUnlock()
+	if ok || !(stale || canRefetch) {
+		return nil
+	}
+	return ks.refresh(ctx)
+}
+
+// refreshInBackground refreshes stale keys unless a refresh is running.
+func (ks *KeySet) refreshInBackground() {
+	if !ks.refreshing.TryLock() {
+		return
+	}
+	defer ks.refreshing.Unlock()
+
+	ks.mu.RLock()
+	stale, _ := ks.due(time.Now())
+	ks.mu.RUnlock()
+	if !stale {
+		return
+	}
+
+	if err := ks.refresh(context.Background()); err != nil {
+		slog.Warn("error refreshing JWKS, keeping the cached keys", "url", ks.url, "error", err)
+	}
+}
+
+// lookup falls back to the only key of the set when the token has no kid.
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// refresh loads the keys and records the attempt, a failure delays the next
+// one.
+func (ks *KeySet) refresh(ctx context.Context) error {
+	keys, err := ks.fetch(ctx)
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	ks.attemptedAt = now
+	if err != nil {
+		ks.failures++
+		retry := refreshRetry
+		for i := 1; i < ks.failures && retry < maxRefreshRetry; i++ {
+			retry *= 2
+		}
+		ks.retryAt = now.Add(min(retry, maxRefreshRetry))
+		return err
+	}
+
+	ks.keys = keys
+	ks.fetchedAt = now
+	ks.failures = 0
+	ks.retryAt = time.Time{}
+	return nil
+}
+
+func (ks *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := ks.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("error decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing JWK %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no signing keys")
+	}
+	return keys, nil
+}
+
+func (ks *KeySet) load(ctx context.Context) ([]byte, error) {
+	if ks.file != "" {
+		data, err := os.ReadFile(ks.file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading JWKS file: %w", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching JWKS: unexpected response status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves a single Ed25519 key under kid "k1". While failing it
+// answers 503 after delay, like an overloaded identity provider.
+type jwksServer struct {
+	fetches atomic.Int32
+	failing atomic.Bool
+	delay   time.Duration
+	body    string
+}
+
+func newJWKSServer(t *testing.T, delay time.Duration) (*jwksServer, *httptest.Server) {
+	t.Helper()
+	public, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js := &jwksServer{
+		delay: delay,
+		body:  fmt.Sprintf(`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"k1","x":%q}]}`, base64.RawURLEncoding.EncodeToString(public)),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js.fetches.Add(1)
+		if js.failing.Load() {
+			time.Sleep(js.delay)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(js.body))
+	}))
+	t.Cleanup(server.Close)
+	return js, server
+}
+
+func TestKeySetServesStaleKeysDuringOutage(t *testing.T) {
+	js, server := newJWKSServer(t, 200*time.Millisecond)
+	ks, err := NewURLKeySet(server.URL, time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewURLKeySet: %v", err)
+	}
+	js.failing.Store(true)
+	time.Sleep(5 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ks.Key(context.Background(), "k1"); err != nil {
+				t.Errorf("Key: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > js.delay/2 {
+		t.Errorf("Key with stale keys took %s, want it not to wait for the endpoint", elapsed)
+	}
+
+	// Let the background refresh fail, the next ones wait for the backoff.
+	time.Sleep(2 * js.delay)
+	for range 20 {
+		if _, err := ks.Key(context.Background(), "k1"); err != nil {
+			t.Fatalf("Key after failed refresh: %v", err)
+		}
+	}
+	time.Sleep(2 * js.delay)
+	if fetches := js.fetches.Load(); fetches != 2 {
+		t.Errorf("endpoint fetched %d times, want the initial fetch and one refresh", fetches)
+	}
+}
+
+func TestKeySetUnknownKeyRefreshesOnce(t *testing.T) {
+	js, server := newJWKSServer(t, 50*time.Millisecond)
+	ks, err := NewURLKeySet(server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("NewURLKeySet: %v", err)
+	}
+	js.failing.Store(true)
+	// Unknown key IDs may trigger a refetch only minRefetchInterval after
+	// the last attempt.
+	ks.mu.Lock()
+	ks.attemptedAt = time.Now().Add(-2 * minRefetchInterval)
+	ks.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ks.Key(context.Background(), "k2"); err == nil {
+				t.Errorf("Key of an unknown kid succeeded")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := ks.Key(context.Background(), "k1"); err != nil {
+		t.Errorf("Key of the cached kid: %v", err)
+	}
+	if fetches := js.fetches.Load(); fetches != 2 {
+		t.Errorf("endpoint fetched %d times, want the initial fetch and one refresh", fetches)
+	}
+}
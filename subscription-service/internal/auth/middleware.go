@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"subscription-service/internal/config"
+	"subscription-service/internal/problem"
+)
+
+var signingMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+const HeaderAPIKey = "X-API-Key"
+
+// APIKeyVerifier resolves a plaintext API key to its principal.
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (*Principal, error)
+}
+
+type Authenticator struct {
+	keys    *KeySet
+	parser  *jwt.Parser
+	apiKeys APIKeyVerifier
+	cfg     config.AuthConfig
+}
+
+// NewAuthenticator accepts JWTs when a JWKS source is configured and API keys
+// when apiKeys is not nil.
+func NewAuthenticator(cfg config.AuthConfig, apiKeys APIKeyVerifier) (*Authenticator, error) {
+	var keys *KeySet
+	var err error
+
+	switch {
+	case cfg.JWKSFile != "":
+		keys, err = NewFileKeySet(cfg.JWKSFile)
+	case cfg.JWKSURL != "":
+		keys, err = NewURLKeySet(cfg.JWKSURL, cfg.JWKSRefresh)
+	case apiKeys == nil:
+		return nil, fmt.Errorf("auth requires jwks_file or jwks_url")
+	default:
+		slog.Warn("no JWKS configured, only API keys are accepted")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &Authenticator{
+		keys:    keys,
+		parser:  jwt.NewParser(options...),
+		apiKeys: apiKeys,
+		cfg:     cfg,
+	}, nil
+}
+
+// Middleware rejects requests without a valid bearer token and stores the
+// caller in the request context for the service layer.
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := a.Authenticate(c.Request)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "authentication failed", "error", err)
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			problem.Abort(c, problem.New(http.StatusUnauthorized, "unauthorized", "unauthorized"))
+			return
+		}
+
+		c.Request = c.Request.WithContext(WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		if a.apiKeys == nil {
+			return nil, fmt.Errorf("api keys are not supported")
+		}
+		return a.apiKeys.VerifyAPIKey(r.Context(), key)
+	}
+
+	if a.keys == nil {
+		return nil, fmt.Errorf("missing api key")
+	}
+
+	header := r.Header.Get("Authorization")
+	tokenString, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || tokenString == "" {
+		return nil, fmt.Errorf("missing bearer token")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.keys.Key(r.Context(), kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+
+	roles := rolesFromClaims(claims, a.cfg.RolesClaim)
+	principal := &Principal{Subject: subject, Roles: roles}
+	principal.Admin = principal.HasRole(a.cfg.AdminRole)
+	principal.TenantID, _ = claims[a.cfg.TenantClaim].(string)
+
+	return principal, nil
+}
+
+// RequireAdmin allows only callers with the admin role. Without a principal
+// (authentication disabled) the request is let through.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFromContext(c.Request.Context())
+		if ok && !principal.Admin {
+			problem.Abort(c, problem.New(http.StatusForbidden, "forbidden", "forbidden"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePlatformAdmin allows only admins that are not bound to a tenant.
+func RequirePlatformAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFromContext(c.Request.Context())
+		if ok && !principal.IsPlatformAdmin() {
+			problem.Abort(c, problem.New(http.StatusForbidden, "forbidden", "forbidden"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope allows API keys only if they were issued with scope. Users
+// and requests without a principal are let through.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFromContext(c.Request.Context())
+		if ok && !principal.HasScope(scope) {
+			problem.Abort(c, problem.New(http.StatusForbidden, "missing_scope", "missing scope "+scope))
+			return
+		}
+		c.Next()
+	}
+}
+
+// rolesFromClaims reads roles from a dot separated claim path, e.g.
+// "realm_access.roles". Both JSON arrays and space separated strings are
+// accepted.
+func rolesFromClaims(claims jwt.MapClaims, path string) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		roles := make([]string, 0, len(v))
+		for _, item := range v {
+			if role, ok := item.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	default:
+		return nil
+	}
+}
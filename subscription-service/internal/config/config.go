@@ -1,47 +1,299 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server" env-prefix:"SERVER_"`
-	Database DatabaseConfig `yaml:"database" env-prefix:"DB_"`
+	// Storage is "postgres", "memory" or "file". The memory and file storages
+	// keep only users and subscriptions, in memory nothing survives a restart.
+	Storage      string             `yaml:"storage" env:"STORAGE" env-default:"postgres"`
+	FileStorage  FileStorageConfig  `yaml:"file_storage" env-prefix:"FILE_STORAGE_"`
+	Server       ServerConfig       `yaml:"server" env-prefix:"SERVER_"`
+	Database     DatabaseConfig     `yaml:"database" env-prefix:"DB_"`
+	Log          LogConfig          `yaml:"log" env-prefix:"LOG_"`
+	Webhooks     WebhookConfig      `yaml:"webhooks" env-prefix:"WEBHOOK_"`
+	Events       EventsConfig       `yaml:"events" env-prefix:"EVENTS_"`
+	Auth         AuthConfig         `yaml:"auth" env-prefix:"AUTH_"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit" env-prefix:"RATE_LIMIT_"`
+	Tracing      TracingConfig      `yaml:"tracing" env-prefix:"TRACING_"`
+	Health       HealthConfig       `yaml:"health" env-prefix:"HEALTH_"`
+	SummaryCache SummaryCacheConfig `yaml:"summary_cache" env-prefix:"SUMMARY_CACHE_"`
 }
 
+// ServerConfig configures the HTTP server. On SIGTERM /readyz fails for
+// DrainDelay before the server stops accepting connections, ShutdownTimeout
+// then bounds draining in-flight requests and stopping background workers.
 type ServerConfig struct {
-	Port string `yaml:"port" env:"PORT" env-default:"8080"`
-	Host string `yaml:"host" env:"HOST" env-default:"localhost"`
+	Port              string        `yaml:"port" env:"PORT" env-default:"8080"`
+	Host              string        `yaml:"host" env:"HOST" env-default:"localhost"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT" env-default:"15s"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT" env-default:"5s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" env-default:"30s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT" env-default:"2m"`
+	DrainDelay        time.Duration `yaml:"drain_delay" env:"DRAIN_DELAY" env-default:"5s"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-default:"30s"`
+	TLS               TLSConfig     `yaml:"tls" env-prefix:"TLS_"`
+	CORS              CORSConfig    `yaml:"cors" env-prefix:"CORS_"`
 }
 
+// TLSConfig enables HTTPS when CertFile and KeyFile are set. The files are
+// reloaded when they change, checked every ReloadInterval. With ClientCAFile
+// client certificates signed by it are verified, and required with
+// RequireClientCert.
+type TLSConfig struct {
+	CertFile          string        `yaml:"cert_file" env:"CERT_FILE"`
+	KeyFile           string        `yaml:"key_file" env:"KEY_FILE"`
+	ClientCAFile      string        `yaml:"client_ca_file" env:"CLIENT_CA_FILE"`
+	RequireClientCert bool          `yaml:"require_client_cert" env:"REQUIRE_CLIENT_CERT"`
+	ReloadInterval    time.Duration `yaml:"reload_interval" env:"RELOAD_INTERVAL" env-default:"1m"`
+}
+
+// CORSConfig allows browsers on AllowedOrigins to call the API, "*" allows
+// any origin. An empty AllowedOrigins disables CORS.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"ALLOWED_METHODS" env-default:"GET,POST,PUT,DELETE"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"ALLOWED_HEADERS" env-default:"Authorization,Content-Type,X-API-Key,X-Tenant-ID,X-Request-ID,If-Match,Accept-Date-Format"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env:"EXPOSED_HEADERS" env-default:"ETag,Retry-After,X-RateLimit-Limit,X-RateLimit-Remaining,X-Request-ID"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"MAX_AGE" env-default:"10m"`
+}
+
+// DatabaseConfig configures the primary and, optionally, read replicas given
+// as connection strings. Replicas are checked every ReplicaCheckInterval, a
+// client's reads stay on the primary for ReadYourWritesWindow after its write.
+//
+// The pool settings and StatementTimeout apply to the primary and every
+// replica, a replica connection string may set its own statement_timeout. On
+// startup the primary is retried for up to ConnectTimeout, waiting from
+// ConnectInitialBackoff up to ConnectMaxBackoff between attempts. A zero
+// StatementTimeout lets statements run indefinitely, a zero MaxOpenConns
+// leaves the pools unbounded.
 type DatabaseConfig struct {
-	Host     string `yaml:"host" env:"HOST" env-default:"localhost"`
-	Port     string `yaml:"port" env:"PORT" env-default:"5432"`
-	User     string `yaml:"user" env:"USER" env-default:"postgres"`
-	Password string `yaml:"password" env:"PASSWORD" env-default:"password"`
-	Name     string `yaml:"name" env:"NAME" env-default:"subscriptions"`
-	SSLMode  string `yaml:"sslmode" env:"SSLMODE" env-default:"disable"`
+	Host                  string        `yaml:"host" env:"HOST" env-default:"localhost"`
+	Port                  string        `yaml:"port" env:"PORT" env-default:"5432"`
+	User                  string        `yaml:"user" env:"USER" env-default:"postgres"`
+	Password              string        `yaml:"password" env:"PASSWORD" env-default:"password"`
+	Name                  string        `yaml:"name" env:"NAME" env-default:"subscriptions"`
+	SSLMode               string        `yaml:"sslmode" env:"SSLMODE" env-default:"disable"`
+	Replicas              []string      `yaml:"replicas" env:"REPLICAS"`
+	ReplicaCheckInterval  time.Duration `yaml:"replica_check_interval" env:"REPLICA_CHECK_INTERVAL" env-default:"5s"`
+	ReadYourWritesWindow  time.Duration `yaml:"read_your_writes_window" env:"READ_YOUR_WRITES_WINDOW" env-default:"5s"`
+	MaxOpenConns          int           `yaml:"max_open_conns" env:"MAX_OPEN_CONNS" env-default:"25"`
+	MaxIdleConns          int           `yaml:"max_idle_conns" env:"MAX_IDLE_CONNS" env-default:"10"`
+	ConnMaxLifetime       time.Duration `yaml:"conn_max_lifetime" env:"CONN_MAX_LIFETIME" env-default:"30m"`
+	ConnMaxIdleTime       time.Duration `yaml:"conn_max_idle_time" env:"CONN_MAX_IDLE_TIME" env-default:"5m"`
+	StatementTimeout      time.Duration `yaml:"statement_timeout" env:"STATEMENT_TIMEOUT" env-default:"30s"`
+	ConnectTimeout        time.Duration `yaml:"connect_timeout" env:"CONNECT_TIMEOUT" env-default:"1m"`
+	ConnectInitialBackoff time.Duration `yaml:"connect_initial_backoff" env:"CONNECT_INITIAL_BACKOFF" env-default:"500ms"`
+	ConnectMaxBackoff     time.Duration `yaml:"connect_max_backoff" env:"CONNECT_MAX_BACKOFF" env-default:"10s"`
+	PoolCheckInterval     time.Duration `yaml:"pool_check_interval" env:"POOL_CHECK_INTERVAL" env-default:"10s"`
+}
+
+// FileStorageConfig configures the file storage. Path is an append-only log
+// compacted every CompactInterval, zero compacts only on startup.
+type FileStorageConfig struct {
+	Path            string        `yaml:"path" env:"PATH" env-default:"data/subscriptions.jsonl"`
+	CompactInterval time.Duration `yaml:"compact_interval" env:"COMPACT_INTERVAL" env-default:"10m"`
+}
+
+// LogConfig configures the process logger. Level is one of "debug", "info",
+// "warn" and "error", Format is "json" or "text".
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LEVEL" env-default:"info"`
+	Format string `yaml:"format" env:"FORMAT" env-default:"json"`
+}
+
+// WebhookConfig configures the delivery worker. Receivers on loopback,
+// private and link-local addresses are refused unless they are in one of
+// AllowedNetworks, given in CIDR notation.
+type WebhookConfig struct {
+	MaxAttempts     int           `yaml:"max_attempts" env:"MAX_ATTEMPTS" env-default:"8"`
+	InitialBackoff  time.Duration `yaml:"initial_backoff" env:"INITIAL_BACKOFF" env-default:"10s"`
+	MaxBackoff      time.Duration `yaml:"max_backoff" env:"MAX_BACKOFF" env-default:"1h"`
+	PollInterval    time.Duration `yaml:"poll_interval" env:"POLL_INTERVAL" env-default:"2s"`
+	BatchSize       int           `yaml:"batch_size" env:"BATCH_SIZE" env-default:"20"`
+	Timeout         time.Duration `yaml:"timeout" env:"TIMEOUT" env-default:"10s"`
+	AllowedNetworks []string      `yaml:"allowed_networks" env:"ALLOWED_NETWORKS"`
+}
+
+// EventsConfig configures the outbox relay. Publishers is a list of
+// "webhook", "stdout", "file" and "http".
+type EventsConfig struct {
+	Publishers     []string      `yaml:"publishers" env:"PUBLISHERS" env-default:"webhook"`
+	Source         string        `yaml:"source" env:"SOURCE" env-default:"/subscription-service"`
+	FilePath       string        `yaml:"file_path" env:"FILE_PATH" env-default:"events.jsonl"`
+	HTTPURL        string        `yaml:"http_url" env:"HTTP_URL"`
+	HTTPTimeout    time.Duration `yaml:"http_timeout" env:"HTTP_TIMEOUT" env-default:"10s"`
+	PollInterval   time.Duration `yaml:"poll_interval" env:"POLL_INTERVAL" env-default:"1s"`
+	BatchSize      int           `yaml:"batch_size" env:"BATCH_SIZE" env-default:"100"`
+	Lease          time.Duration `yaml:"lease" env:"LEASE" env-default:"1m"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" env:"INITIAL_BACKOFF" env-default:"1s"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" env:"MAX_BACKOFF" env-default:"5m"`
+}
+
+// AuthConfig configures authentication. JWTs are verified against a JWKS
+// loaded from JWKSFile or JWKSURL, API keys are always accepted.
+type AuthConfig struct {
+	Enabled     bool          `yaml:"enabled" env:"ENABLED"`
+	JWKSFile    string        `yaml:"jwks_file" env:"JWKS_FILE"`
+	JWKSURL     string        `yaml:"jwks_url" env:"JWKS_URL"`
+	JWKSRefresh time.Duration `yaml:"jwks_refresh" env:"JWKS_REFRESH" env-default:"15m"`
+	Issuer      string        `yaml:"issuer" env:"ISSUER"`
+	Audience    string        `yaml:"audience" env:"AUDIENCE"`
+	RolesClaim  string        `yaml:"roles_claim" env:"ROLES_CLAIM" env-default:"roles"`
+	AdminRole   string        `yaml:"admin_role" env:"ADMIN_ROLE" env-default:"admin"`
+	TenantClaim string        `yaml:"tenant_claim" env:"TENANT_CLAIM" env-default:"tenant_id"`
+	Leeway      time.Duration `yaml:"leeway" env:"LEEWAY" env-default:"30s"`
+	// APIKeyRotationGrace is how long a rotated API key stays valid.
+	APIKeyRotationGrace time.Duration `yaml:"api_key_rotation_grace" env:"API_KEY_ROTATION_GRACE" env-default:"24h"`
+}
+
+// RateLimitConfig configures per-client token buckets. Backend is "memory"
+// for a single replica or "postgres" to share the buckets between replicas.
+// IP limits every IP address across all routes before authentication.
+type RateLimitConfig struct {
+	Enabled bool          `yaml:"enabled" env:"ENABLED"`
+	Backend string        `yaml:"backend" env:"BACKEND" env-default:"memory"`
+	IdleTTL time.Duration `yaml:"idle_ttl" env:"IDLE_TTL" env-default:"10m"`
+	IP      RateLimitRule `yaml:"ip" env-prefix:"IP_"`
+	Read    RateLimitRule `yaml:"read" env-prefix:"READ_"`
+	Write   RateLimitRule `yaml:"write" env-prefix:"WRITE_"`
+	Summary RateLimitRule `yaml:"summary" env-prefix:"SUMMARY_"`
+	Admin   RateLimitRule `yaml:"admin" env-prefix:"ADMIN_"`
+}
+
+// RateLimitRule allows Burst requests at once, refilled at Rate requests per
+// second. A zero Rate disables the limit for the route group.
+type RateLimitRule struct {
+	Rate  float64 `yaml:"rate" env:"RATE"`
+	Burst int     `yaml:"burst" env:"BURST"`
+}
+
+// TracingConfig configures OpenTelemetry tracing. Exporter is "stdout" or
+// "otlp", the latter sends spans over OTLP/HTTP to Endpoint.
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled" env:"ENABLED"`
+	Exporter    string  `yaml:"exporter" env:"EXPORTER" env-default:"otlp"`
+	Endpoint    string  `yaml:"endpoint" env:"ENDPOINT" env-default:"http://localhost:4318"`
+	ServiceName string  `yaml:"service_name" env:"SERVICE_NAME" env-default:"subscription-service"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"SAMPLE_RATIO" env-default:"1"`
+}
+
+// HealthConfig configures the /livez and /readyz probes. A background worker
+// is reported unhealthy after WorkerStaleAfter without activity.
+type HealthConfig struct {
+	CheckTimeout       time.Duration `yaml:"check_timeout" env:"CHECK_TIMEOUT" env-default:"2s"`
+	WorkerStaleAfter   time.Duration `yaml:"worker_stale_after" env:"WORKER_STALE_AFTER" env-default:"2m"`
+	DetailsRequireAuth bool          `yaml:"details_require_auth" env:"DETAILS_REQUIRE_AUTH"`
+}
+
+// SummaryCacheConfig configures caching of summaries. An entry is kept for
+// at most TTL, the least recently used entry is evicted beyond MaxEntries.
+type SummaryCacheConfig struct {
+	Enabled    bool          `yaml:"enabled" env:"ENABLED"`
+	TTL        time.Duration `yaml:"ttl" env:"TTL" env-default:"1m"`
+	MaxEntries int           `yaml:"max_entries" env:"MAX_ENTRIES" env-default:"10000"`
 }
 
-func Load() (*Config, error) {
-	var cfg Config
+// DefaultPath is read when no configuration file is given. Unlike a given
+// file it may be missing, for deployments configured by the environment only.
+const DefaultPath = "config/config.yaml"
 
-	err := cleanenv.ReadConfig("config/config.yaml", &cfg)
+// Load reads and validates the configuration, see Read.
+func Load(path, profile string) (*Config, error) {
+	cfg, err := Read(path, profile)
 	if err != nil {
-		log.Printf("Warning: config.yaml not found, using environment variables and defaults: %v", err)
+		return nil, err
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
 
-	err = cleanenv.ReadEnv(&cfg)
-	if err != nil {
+// Read reads the file at path, or DefaultPath if path is empty, then the
+// overlay of profile next to it and then the environment, each overriding
+// the previous. Defaults apply only to keys set nowhere, so a zero in a file
+// is kept. Unknown keys in the files are errors.
+func Read(path, profile string) (*Config, error) {
+	// The environment is read first to get the defaults, the variables
+	// that are set are applied again on top of the files.
+	var env Config
+	if err := cleanenv.ReadEnv(&env); err != nil {
 		return nil, fmt.Errorf("error reading environment variables: %w", err)
 	}
+	cfg := env
 
-	log.Printf("Configuration loaded successfully: Server=%s:%s, DB=%s@%s:%s",
-		cfg.Server.Host, cfg.Server.Port,
-		cfg.Database.User, cfg.Database.Host, cfg.Database.Port)
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath
+	}
+	if err := readFile(path, &cfg); err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		slog.Warn("config file not found, using environment variables and defaults", "path", path)
+	}
 
+	if profile != "" {
+		if err := readFile(ProfilePath(path, profile), &cfg); err != nil {
+			return nil, fmt.Errorf("failed to read profile %q: %w", profile, err)
+		}
+	}
+
+	overrideFromEnv(reflect.ValueOf(&cfg).Elem(), reflect.ValueOf(env), "")
 	return &cfg, nil
 }
+
+// overrideFromEnv copies the fields of env whose environment variable is set
+// to dst, prefix is the env-prefix of the enclosing structs.
+func overrideFromEnv(dst, env reflect.Value, prefix string) {
+	for i := range dst.NumField() {
+		field := dst.Type().Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			overrideFromEnv(dst.Field(i), env.Field(i), prefix+field.Tag.Get("env-prefix"))
+			continue
+		}
+		for _, name := range strings.Split(field.Tag.Get("env"), ",") {
+			if _, ok := os.LookupEnv(prefix + name); name != "" && ok {
+				dst.Field(i).Set(env.Field(i))
+				break
+			}
+		}
+	}
+}
+
+// ProfilePath is the overlay of profile for the file at path, for example
+// config/config.prod.yaml for config/config.yaml.
+func ProfilePath(path, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+func readFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return nil
+}
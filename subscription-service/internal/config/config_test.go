@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadLayering(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		compact time.Duration
+		timeout time.Duration
+		conns   int
+	}{
+		{
+			name:    "defaults",
+			file:    "storage: file\n",
+			compact: 10 * time.Minute,
+			timeout: 30 * time.Second,
+			conns:   25,
+		},
+		{
+			name:    "zeros in the file are kept",
+			file:    "file_storage:\n  compact_interval: 0s\ndatabase:\n  statement_timeout: 0s\n  max_open_conns: 0\n",
+			compact: 0,
+			timeout: 0,
+			conns:   0,
+		},
+		{
+			name:    "the environment overrides the file",
+			file:    "file_storage:\n  compact_interval: 0s\ndatabase:\n  statement_timeout: 0s\n",
+			env:     map[string]string{"FILE_STORAGE_COMPACT_INTERVAL": "1h", "DB_STATEMENT_TIMEOUT": "5s", "DB_MAX_OPEN_CONNS": "0"},
+			compact: time.Hour,
+			timeout: 5 * time.Second,
+			conns:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Read(path, "")
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if cfg.FileStorage.CompactInterval != tt.compact {
+				t.Errorf("compact_interval = %s, want %s", cfg.FileStorage.CompactInterval, tt.compact)
+			}
+			if cfg.Database.StatementTimeout != tt.timeout {
+				t.Errorf("statement_timeout = %s, want %s", cfg.Database.StatementTimeout, tt.timeout)
+			}
+			if cfg.Database.MaxOpenConns != tt.conns {
+				t.Errorf("max_open_conns = %d, want %d", cfg.Database.MaxOpenConns, tt.conns)
+			}
+		})
+	}
+}
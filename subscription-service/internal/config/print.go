@@ -0,0 +1,97 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+// dsnPassword matches the password of a key=value connection string.
+var dsnPassword = regexp.MustCompile(`(password=)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Redacted returns a copy of the configuration with passwords replaced, also
+// those in connection strings and URLs, safe to print or log.
+func (c Config) Redacted() *Config {
+	if c.Database.Password != "" {
+		c.Database.Password = redacted
+	}
+
+	replicas := make([]string, len(c.Database.Replicas))
+	for i, dsn := range c.Database.Replicas {
+		replicas[i] = redactDSN(dsn)
+	}
+	c.Database.Replicas = replicas
+
+	// URLs may carry credentials in their user info or query as well.
+	c.Events.HTTPURL = redactDSN(c.Events.HTTPURL)
+	c.Auth.JWKSURL = redactDSN(c.Auth.JWKSURL)
+	c.Tracing.Endpoint = redactDSN(c.Tracing.Endpoint)
+
+	return &c
+}
+
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+// MarshalYAML renders the configuration in the layout of the configuration
+// file, with durations written like "30s".
+func (c Config) MarshalYAML() (any, error) {
+	return yamlNode(reflect.ValueOf(c))
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+func yamlNode(v reflect.Value) (*yaml.Node, error) {
+	switch {
+	case v.Type() == durationType:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: v.Interface().(time.Duration).String()}, nil
+	case v.Kind() == reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := range v.NumField() {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			value, err := yamlNode(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+		}
+		return node, nil
+	case v.Kind() == reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := range v.Len() {
+			value, err := yamlNode(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		return node, nil
+	default:
+		var node yaml.Node
+		if err := node.Encode(v.Interface()); err != nil {
+			return nil, err
+		}
+		return &node, nil
+	}
+}
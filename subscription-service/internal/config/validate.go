@@ -0,0 +1,188 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// validator collects the problems of a configuration, so that they are all
+// reported at once instead of one per restart.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) check(ok bool, field, format string, args ...any) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	v.check(slices.Contains(allowed, value), field, "%q is not one of %q", value, allowed)
+}
+
+func (v *validator) positive(field string, value interface{ Nanoseconds() int64 }) {
+	v.check(value.Nanoseconds() > 0, field, "must be positive")
+}
+
+func (v *validator) notNegative(field string, value int) {
+	v.check(value >= 0, field, "must not be negative")
+}
+
+func (v *validator) port(field, value string) {
+	port, err := strconv.Atoi(value)
+	v.check(err == nil && port > 0 && port < 65536, field, "%q is not a port number", value)
+}
+
+// Validate checks every field of the configuration and returns all problems
+// joined, nil if there are none.
+func (c *Config) Validate() error {
+	var v validator
+
+	v.oneOf("storage", c.Storage, "postgres", "memory", "file")
+	if c.Storage == "file" {
+		v.check(c.FileStorage.Path != "", "file_storage.path", "is required for the file storage")
+	}
+	v.check(c.FileStorage.CompactInterval >= 0, "file_storage.compact_interval", "must not be negative")
+
+	c.Server.validate(&v)
+	c.Database.validate(&v)
+
+	v.oneOf("log.level", c.Log.Level, "debug", "info", "warn", "error")
+	v.oneOf("log.format", c.Log.Format, "json", "text")
+
+	v.check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts", "must be positive")
+	v.positive("webhooks.initial_backoff", c.Webhooks.InitialBackoff)
+	v.check(c.Webhooks.MaxBackoff >= c.Webhooks.InitialBackoff, "webhooks.max_backoff", "must not be less than initial_backoff")
+	v.positive("webhooks.poll_interval", c.Webhooks.PollInterval)
+	v.check(c.Webhooks.BatchSize > 0, "webhooks.batch_size", "must be positive")
+	v.positive("webhooks.timeout", c.Webhooks.Timeout)
+	for _, network := range c.Webhooks.AllowedNetworks {
+		_, err := netip.ParsePrefix(network)
+		v.check(err == nil, "webhooks.allowed_networks", "%q is not a CIDR network", network)
+	}
+
+	for _, publisher := range c.Events.Publishers {
+		v.oneOf("events.publishers", publisher, "webhook", "stdout", "file", "http")
+	}
+	if slices.Contains(c.Events.Publishers, "file") {
+		v.check(c.Events.FilePath != "", "events.file_path", "is required for the file publisher")
+	}
+	if slices.Contains(c.Events.Publishers, "http") {
+		v.check(isURL(c.Events.HTTPURL), "events.http_url", "%q is not an absolute URL", c.Events.HTTPURL)
+	}
+	v.positive("events.http_timeout", c.Events.HTTPTimeout)
+	v.positive("events.poll_interval", c.Events.PollInterval)
+	v.check(c.Events.BatchSize > 0, "events.batch_size", "must be positive")
+	v.positive("events.lease", c.Events.Lease)
+	v.positive("events.initial_backoff", c.Events.InitialBackoff)
+	v.check(c.Events.MaxBackoff >= c.Events.InitialBackoff, "events.max_backoff", "must not be less than initial_backoff")
+
+	v.check(c.Auth.JWKSFile == "" || c.Auth.JWKSURL == "", "auth.jwks_url", "cannot be combined with jwks_file")
+	if c.Auth.JWKSURL != "" {
+		v.check(isURL(c.Auth.JWKSURL), "auth.jwks_url", "%q is not an absolute URL", c.Auth.JWKSURL)
+		v.positive("auth.jwks_refresh", c.Auth.JWKSRefresh)
+	}
+	if c.Auth.Enabled && c.Storage != "postgres" {
+		// Without Postgres there are no API keys to fall back to.
+		v.check(c.Auth.JWKSFile != "" || c.Auth.JWKSURL != "", "auth", "jwks_file or jwks_url is required without postgres storage")
+	}
+	v.check(c.Auth.RolesClaim != "", "auth.roles_claim", "is required")
+	v.check(c.Auth.AdminRole != "", "auth.admin_role", "is required")
+	v.check(c.Auth.TenantClaim != "", "auth.tenant_claim", "is required")
+	v.check(c.Auth.Leeway >= 0, "auth.leeway", "must not be negative")
+	v.check(c.Auth.APIKeyRotationGrace >= 0, "auth.api_key_rotation_grace", "must not be negative")
+
+	v.oneOf("rate_limit.backend", c.RateLimit.Backend, "memory", "postgres")
+	if c.RateLimit.Enabled && c.RateLimit.Backend == "postgres" {
+		v.check(c.Storage == "postgres", "rate_limit.backend", "postgres requires postgres storage")
+	}
+	v.check(c.RateLimit.IdleTTL >= 0, "rate_limit.idle_ttl", "must not be negative")
+	rules := []struct {
+		name string
+		rule RateLimitRule
+	}{
+		{"ip", c.RateLimit.IP}, {"read", c.RateLimit.Read}, {"write", c.RateLimit.Write}, {"summary", c.RateLimit.Summary}, {"admin", c.RateLimit.Admin},
+	}
+	for _, r := range rules {
+		v.check(r.rule.Rate >= 0, "rate_limit."+r.name+".rate", "must not be negative")
+		v.check(r.rule.Rate == 0 || r.rule.Burst > 0, "rate_limit."+r.name+".burst", "must be positive when rate is set")
+	}
+
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, "stdout", "otlp")
+	if c.Tracing.Exporter == "otlp" {
+		v.check(isURL(c.Tracing.Endpoint), "tracing.endpoint", "%q is not an absolute URL", c.Tracing.Endpoint)
+	}
+	v.check(c.Tracing.ServiceName != "", "tracing.service_name", "is required")
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1")
+
+	v.positive("health.check_timeout", c.Health.CheckTimeout)
+	v.positive("health.worker_stale_after", c.Health.WorkerStaleAfter)
+
+	if c.SummaryCache.Enabled {
+		v.positive("summary_cache.ttl", c.SummaryCache.TTL)
+		v.check(c.SummaryCache.MaxEntries > 0, "summary_cache.max_entries", "must be positive")
+	}
+
+	return errors.Join(v.errs...)
+}
+
+func (c *ServerConfig) validate(v *validator) {
+	v.port("server.port", c.Port)
+	v.check(c.ReadTimeout >= 0, "server.read_timeout", "must not be negative")
+	v.check(c.ReadHeaderTimeout >= 0, "server.read_header_timeout", "must not be negative")
+	v.check(c.WriteTimeout >= 0, "server.write_timeout", "must not be negative")
+	v.check(c.IdleTimeout >= 0, "server.idle_timeout", "must not be negative")
+	v.check(c.DrainDelay >= 0, "server.drain_delay", "must not be negative")
+	v.positive("server.shutdown_timeout", c.ShutdownTimeout)
+
+	tls := c.TLS
+	v.check((tls.CertFile == "") == (tls.KeyFile == ""), "server.tls", "cert_file and key_file must be set together")
+	v.check(tls.ClientCAFile == "" || tls.CertFile != "", "server.tls.client_ca_file", "requires cert_file and key_file")
+	v.check(!tls.RequireClientCert || tls.ClientCAFile != "", "server.tls.require_client_cert", "requires client_ca_file")
+	if tls.CertFile != "" {
+		v.positive("server.tls.reload_interval", tls.ReloadInterval)
+	}
+
+	cors := c.CORS
+	for _, origin := range cors.AllowedOrigins {
+		v.check(origin == "*" || isURL(origin), "server.cors.allowed_origins", "%q is neither * nor an origin like https://example.com", origin)
+	}
+	if len(cors.AllowedOrigins) > 0 {
+		v.check(len(cors.AllowedMethods) > 0, "server.cors.allowed_methods", "must not be empty")
+	}
+	v.check(cors.MaxAge >= 0, "server.cors.max_age", "must not be negative")
+}
+
+func (c *DatabaseConfig) validate(v *validator) {
+	v.check(c.Host != "", "database.host", "is required")
+	v.port("database.port", c.Port)
+	v.check(c.User != "", "database.user", "is required")
+	v.check(c.Name != "", "database.name", "is required")
+	v.oneOf("database.sslmode", c.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	for _, replica := range c.Replicas {
+		v.check(replica != "", "database.replicas", "must not contain empty connection strings")
+	}
+	v.positive("database.replica_check_interval", c.ReplicaCheckInterval)
+	v.check(c.ReadYourWritesWindow >= 0, "database.read_your_writes_window", "must not be negative")
+
+	v.notNegative("database.max_open_conns", c.MaxOpenConns)
+	v.notNegative("database.max_idle_conns", c.MaxIdleConns)
+	v.check(c.MaxOpenConns == 0 || c.MaxIdleConns <= c.MaxOpenConns, "database.max_idle_conns", "must not exceed max_open_conns")
+	v.check(c.ConnMaxLifetime >= 0, "database.conn_max_lifetime", "must not be negative")
+	v.check(c.ConnMaxIdleTime >= 0, "database.conn_max_idle_time", "must not be negative")
+	v.check(c.StatementTimeout >= 0, "database.statement_timeout", "must not be negative")
+	v.check(c.ConnectTimeout >= 0, "database.connect_timeout", "must not be negative")
+	v.positive("database.connect_initial_backoff", c.ConnectInitialBackoff)
+	v.check(c.ConnectMaxBackoff >= c.ConnectInitialBackoff, "database.connect_max_backoff", "must not be less than connect_initial_backoff")
+	v.positive("database.pool_check_interval", c.PoolCheckInterval)
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
@@ -0,0 +1,50 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+
+	"subscription-service/internal/model"
+)
+
+const (
+	SpecVersion = "1.0"
+
+	// SchemaVersion is the version of the data payload written for new events.
+	// Bump it whenever the JSON shape of model.Subscription changes.
+	// Version 2 switched subscription dates from MM-YYYY to YYYY-MM.
+	SchemaVersion = "2"
+
+	ContentType = "application/cloudevents+json"
+)
+
+// Envelope is a CloudEvents 1.0 event in structured JSON mode. SchemaVersion
+// and TenantID are carried as the "schemaversion" and "tenantid" extension
+// attributes.
+type Envelope struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	SchemaVersion   string          `json:"schemaversion"`
+	TenantID        string          `json:"tenantid"`
+	Data            json.RawMessage `json:"data"`
+}
+
+func NewEnvelope(source string, msg *model.OutboxMessage) Envelope {
+	return Envelope{
+		SpecVersion:     SpecVersion,
+		ID:              msg.ID,
+		Source:          source,
+		Type:            msg.EventType,
+		Subject:         msg.AggregateType + "/" + msg.AggregateID,
+		Time:            msg.CreatedAt.UTC(),
+		DataContentType: "application/json",
+		SchemaVersion:   msg.SchemaVersion,
+		TenantID:        msg.TenantID,
+		Data:            msg.Payload,
+	}
+}
@@ -0,0 +1,50 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type httpPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPPublisher POSTs every event to url in CloudEvents structured mode.
+func NewHTTPPublisher(url string, timeout time.Duration) EventPublisher {
+	return &httpPublisher{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *httpPublisher) Publish(ctx context.Context, envelope Envelope) error {
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("error encoding event %s: %w", envelope.ID, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error publishing event %s: %w", envelope.ID, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("error publishing event %s: unexpected response status %d", envelope.ID, resp.StatusCode)
+	}
+
+	return nil
+}
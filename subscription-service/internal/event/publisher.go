@@ -0,0 +1,33 @@
+package event
+
+import (
+	"context"
+	"errors"
+)
+
+// EventPublisher delivers an event to an external system. Delivery is
+// at-least-once: the relay retries failed events, so consumers must
+// deduplicate by Envelope.ID.
+type EventPublisher interface {
+	Publish(ctx context.Context, envelope Envelope) error
+}
+
+type multiPublisher struct {
+	publishers []EventPublisher
+}
+
+// NewMultiPublisher fans an event out to every publisher. The event counts
+// as published only when all of them succeed.
+func NewMultiPublisher(publishers ...EventPublisher) EventPublisher {
+	return &multiPublisher{publishers: publishers}
+}
+
+func (p *multiPublisher) Publish(ctx context.Context, envelope Envelope) error {
+	var errs []error
+	for _, publisher := range p.publishers {
+		if err := publisher.Publish(ctx, envelope); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
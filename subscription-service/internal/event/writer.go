@@ -0,0 +1,52 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type writerPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterPublisher writes every event as a single JSON line.
+func NewWriterPublisher(w io.Writer) EventPublisher {
+	return &writerPublisher{w: w}
+}
+
+func NewStdoutPublisher() EventPublisher {
+	return NewWriterPublisher(os.Stdout)
+}
+
+// NewFilePublisher appends events to the file at path, creating it if needed.
+func NewFilePublisher(path string) (EventPublisher, io.Closer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening event file %s: %w", path, err)
+	}
+	return NewWriterPublisher(file), file, nil
+}
+
+func (p *writerPublisher) Publish(ctx context.Context, envelope Envelope) error {
+	line, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("error encoding event %s: %w", envelope.ID, err)
+	}
+	line = append(line, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.w.Write(line); err != nil {
+		return fmt.Errorf("error writing event %s: %w", envelope.ID, err)
+	}
+	if file, ok := p.w.(*os.File); ok && file != os.Stdout {
+		return file.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"subscription-service/internal/model"
+	"subscription-service/internal/service"
+)
+
+type APIKeyHandler struct {
+	service service.APIKeyService
+}
+
+func NewAPIKeyHandler(service service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// IssueAPIKey выпускает API-ключ
+// @Summary Выпустить API-ключ
+// @Description Создает API-ключ с указанными scopes. Ключ возвращается только в этом ответе
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param input body model.CreateAPIKeyRequest true "Данные ключа"
+// @Success 201 {object} model.IssuedAPIKey
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /admin/api-keys [post]
+func (h *APIKeyHandler) IssueAPIKey(c *gin.Context) {
+	var req model.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	key, err := h.service.IssueAPIKey(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// ListAPIKeys возвращает список API-ключей
+// @Summary Список API-ключей
+// @Description Возвращает все API-ключи без секретов
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.APIKey
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /admin/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.service.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RotateAPIKey перевыпускает API-ключ
+// @Summary Перевыпустить API-ключ
+// @Description Выпускает новый ключ с теми же scopes, старый ключ перестает действовать после льготного периода
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param id path string true "ID ключа"
+// @Success 201 {object} model.IssuedAPIKey
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /admin/api-keys/{id}/rotate [post]
+func (h *APIKeyHandler) RotateAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	if !isUUID(id) {
+		invalidID(c, "id")
+		return
+	}
+
+	key, err := h.service.RotateAPIKey(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// RevokeAPIKey отзывает API-ключ
+// @Summary Отозвать API-ключ
+// @Description Немедленно отзывает API-ключ
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param id path string true "ID ключа"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	if !isUUID(id) {
+		invalidID(c, "id")
+		return
+	}
+
+	if err := h.service.RevokeAPIKey(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked successfully"})
+}
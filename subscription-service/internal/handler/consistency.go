@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"subscription-service/internal/tenant"
+	"subscription-service/pkg/database"
+)
+
+// ReadYourWrites sends the reads of a request to the primary database when it
+// is a write or its client wrote within window, so that clients see their own
+// changes despite replication lag. Writes are tracked per process: behind a
+// load balancer the window only holds for requests reaching the same replica.
+func ReadYourWrites(window time.Duration) gin.HandlerFunc {
+	var mu sync.Mutex
+	lastWrite := make(map[string]time.Time)
+	lastSweep := time.Now()
+
+	return func(c *gin.Context) {
+		key := tenant.ClientKey(c)
+		now := time.Now()
+
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			mu.Lock()
+			wrote, ok := lastWrite[key]
+			mu.Unlock()
+			if ok && now.Sub(wrote) < window {
+				c.Request = c.Request.WithContext(database.WithPrimary(c.Request.Context()))
+			}
+			c.Next()
+			return
+		}
+
+		c.Request = c.Request.WithContext(database.WithPrimary(c.Request.Context()))
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		now = time.Now()
+		lastWrite[key] = now
+		if now.Sub(lastSweep) > window {
+			for k, wrote := range lastWrite {
+				if now.Sub(wrote) >= window {
+					delete(lastWrite, k)
+				}
+			}
+			lastSweep = now
+		}
+	}
+}
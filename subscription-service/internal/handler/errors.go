@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/problem"
+	"subscription-service/internal/validation"
+)
+
+// respondError maps domain errors to their HTTP status and writes them as a
+// problem. Anything else is an internal error, its text is only logged.
+func respondError(c *gin.Context, err error) {
+	status := errorStatus(err)
+
+	var appErr *apperror.Error
+	if status == http.StatusInternalServerError || !errors.As(err, &appErr) {
+		slog.ErrorContext(c.Request.Context(), "request failed", "error", err)
+		problem.Abort(c, problem.New(http.StatusInternalServerError, "internal_error", "internal server error"))
+		return
+	}
+
+	p := problem.New(status, appErr.Code, appErr.Message)
+	p.Errors = appErr.Fields
+	problem.Abort(c, p)
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, apperror.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, apperror.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, apperror.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, apperror.ErrForbidden):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// invalidRequest reports a request body or query that could not be bound,
+// listing the offending fields when the binding error names them.
+func invalidRequest(c *gin.Context, err error) {
+	if fields, ok := validation.Fields(err); ok {
+		p := problem.New(http.StatusBadRequest, "validation_failed", "request is invalid")
+		p.Errors = fields
+		problem.Abort(c, p)
+		return
+	}
+	problem.Abort(c, problem.New(http.StatusBadRequest, "invalid_request", err.Error()))
+}
+
+// invalidID reports a path or query parameter that must be a UUID.
+func invalidID(c *gin.Context, name string) {
+	problem.Abort(c, problem.New(http.StatusBadRequest, "invalid_id", name+" must be a valid UUID"))
+}
@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"subscription-service/internal/model"
+	"subscription-service/internal/problem"
 	"subscription-service/internal/service"
 )
 
@@ -23,23 +25,35 @@ func NewSubscriptionHandler(service service.SubscriptionService) *SubscriptionHa
 // @Accept json
 // @Produce json
 // @Param input body model.CreateSubscriptionRequest true "Данные подписки"
+// @Param Accept-Date-Format header string false "Формат дат в ответе: YYYY-MM (по умолчанию) или MM-YYYY"
 // @Success 201 {object} model.Subscription
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /subscriptions [post]
 func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
+	layout, ok := dateLayout(c)
+	if !ok {
+		return
+	}
+
 	var req model.CreateSubscriptionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		invalidRequest(c, err)
 		return
 	}
 
 	subscription, err := h.service.CreateSubscription(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	formatDates(layout, subscription)
 	c.JSON(http.StatusCreated, subscription)
 }
 
@@ -50,20 +64,38 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "ID подписки"
+// @Param Accept-Date-Format header string false "Формат дат в ответе: YYYY-MM (по умолчанию) или MM-YYYY"
 // @Success 200 {object} model.Subscription
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Header 200 {string} ETag "Версия подписки для If-Match"
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /subscriptions/{id} [get]
 func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
 	id := c.Param("id")
+	if !isUUID(id) {
+		invalidID(c, "id")
+		return
+	}
+
+	layout, ok := dateLayout(c)
+	if !ok {
+		return
+	}
 
 	subscription, err := h.service.GetSubscription(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	c.Header("ETag", subscription.ETag())
+	formatDates(layout, subscription)
 	c.JSON(http.StatusOK, subscription)
 }
 
@@ -75,21 +107,33 @@ func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
 // @Produce json
 // @Param id path string true "ID подписки"
 // @Param input body model.UpdateSubscriptionRequest true "Данные для обновления"
+// @Param If-Match header string false "ETag, полученный при чтении подписки"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /subscriptions/{id} [put]
 func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
 	id := c.Param("id")
+	if !isUUID(id) {
+		invalidID(c, "id")
+		return
+	}
 
 	var req model.UpdateSubscriptionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		invalidRequest(c, err)
 		return
 	}
 
-	if err := h.service.UpdateSubscription(c.Request.Context(), id, &req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if _, err := h.service.UpdateSubscription(requestContext(c), id, &req); err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -103,15 +147,27 @@ func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "ID подписки"
+// @Param If-Match header string false "ETag, полученный при чтении подписки"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /subscriptions/{id} [delete]
 func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 	id := c.Param("id")
+	if !isUUID(id) {
+		invalidID(c, "id")
+		return
+	}
 
-	if err := h.service.DeleteSubscription(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if _, err := h.service.DeleteSubscription(requestContext(c), id); err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -126,14 +182,30 @@ func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 // @Produce json
 // @Param user_id query string false "ID пользователя"
 // @Param service_name query string false "Название сервиса"
+// @Param Accept-Date-Format header string false "Формат дат в ответе: YYYY-MM (по умолчанию) или MM-YYYY"
 // @Success 200 {array} model.Subscription
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /subscriptions [get]
 func (h *SubscriptionHandler) ListSubscriptions(c *gin.Context) {
+	layout, ok := dateLayout(c)
+	if !ok {
+		return
+	}
+
 	var userID *string
 	var serviceName *string
 
 	if userIDStr := c.Query("user_id"); userIDStr != "" {
+		if !isUUID(userIDStr) {
+			invalidID(c, "user_id")
+			return
+		}
 		userID = &userIDStr
 	}
 
@@ -143,10 +215,11 @@ func (h *SubscriptionHandler) ListSubscriptions(c *gin.Context) {
 
 	subscriptions, err := h.service.ListSubscriptions(c.Request.Context(), userID, serviceName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	formatDates(layout, subscriptions...)
 	c.JSON(http.StatusOK, subscriptions)
 }
 
@@ -158,17 +231,22 @@ func (h *SubscriptionHandler) ListSubscriptions(c *gin.Context) {
 // @Produce json
 // @Param user_id query string false "ID пользователя"
 // @Param service_name query string false "Название сервиса"
-// @Param start_period query string true "Начало периода (MM-YYYY)"
-// @Param end_period query string true "Конец периода (MM-YYYY)"
+// @Param start_period query string true "Начало периода (YYYY-MM, YYYY-MM-DD, MM-YYYY или DD-MM-YYYY)"
+// @Param end_period query string true "Конец периода (YYYY-MM, YYYY-MM-DD, MM-YYYY или DD-MM-YYYY)"
 // @Success 200 {object} model.SubscriptionSummary
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /summary [get]
 func (h *SubscriptionHandler) GetSummary(c *gin.Context) {
 	var req model.SummaryRequest
 
 	if err := c.ShouldBindQuery(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		invalidRequest(c, err)
 		return
 	}
 	
@@ -178,9 +256,52 @@ func (h *SubscriptionHandler) GetSummary(c *gin.Context) {
 
 	summary, err := h.service.GetSummary(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, summary)
 }
+
+// requestContext carries the If-Match condition of the request to the service.
+func requestContext(c *gin.Context) context.Context {
+	ctx := c.Request.Context()
+	if etags := c.GetHeader("If-Match"); etags != "" {
+		ctx = service.WithIfMatch(ctx, etags)
+	}
+	return ctx
+}
+
+// HeaderAcceptDateFormat lets legacy clients get dates in MM-YYYY instead of
+// the canonical YYYY-MM.
+const HeaderAcceptDateFormat = "Accept-Date-Format"
+
+// dateLayout returns the layout requested with Accept-Date-Format, or writes
+// a problem and reports false for an unsupported one.
+func dateLayout(c *gin.Context) (string, bool) {
+	c.Writer.Header().Add("Vary", HeaderAcceptDateFormat)
+
+	switch format := c.GetHeader(HeaderAcceptDateFormat); format {
+	case "", "YYYY-MM":
+		return model.MonthLayout, true
+	case "MM-YYYY":
+		return model.LegacyMonthLayout, true
+	default:
+		problem.Abort(c, problem.New(http.StatusBadRequest, "unsupported_date_format",
+			HeaderAcceptDateFormat+" must be YYYY-MM or MM-YYYY"))
+		return "", false
+	}
+}
+
+func formatDates(layout string, subscriptions ...*model.Subscription) {
+	if layout == model.MonthLayout {
+		return
+	}
+	for _, s := range subscriptions {
+		s.StartDate = model.FormatMonth(s.StartDate, layout)
+		if s.EndDate != nil {
+			endDate := model.FormatMonth(*s.EndDate, layout)
+			s.EndDate = &endDate
+		}
+	}
+}
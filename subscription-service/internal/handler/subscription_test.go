@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"subscription-service/internal/tenant"
+	"subscription-service/internal/validation"
+)
+
+const (
+	aliceID = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+	ghostID = "00000000-0000-4000-8000-000000000000"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if err := validation.Register(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func newSubscriptionRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	store := repository.NewMemoryStore()
+	users := repository.NewMemoryUserRepository(store)
+	ctx := tenant.WithID(context.Background(), tenant.DefaultID)
+	if err := users.Create(ctx, &model.User{ID: aliceID}); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	h := NewSubscriptionHandler(service.NewSubscriptionService(repository.NewMemorySubscriptionRepository(store), users))
+	r := gin.New()
+	r.POST("/subscriptions", h.CreateSubscription)
+	r.GET("/subscriptions", h.ListSubscriptions)
+	r.GET("/subscriptions/:id", h.GetSubscription)
+	r.PUT("/subscriptions/:id", h.UpdateSubscription)
+	r.DELETE("/subscriptions/:id", h.DeleteSubscription)
+	r.GET("/summary", h.GetSummary)
+	return r
+}
+
+func serve(r http.Handler, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// createFixture stores a subscription through the API and returns its ID and
+// current ETag.
+func createFixture(t *testing.T, r http.Handler) (string, string) {
+	t.Helper()
+
+	w := serve(r, http.MethodPost, "/subscriptions",
+		`{"service_name":"Yandex Plus","price":400,"user_id":"`+aliceID+`","start_date":"07-2025"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /subscriptions = %d %s", w.Code, w.Body)
+	}
+	var created model.Subscription
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decoding created subscription: %v", err)
+	}
+
+	w = serve(r, http.MethodGet, "/subscriptions/"+created.ID, "", nil)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == "" {
+		t.Fatalf("GET /subscriptions/%s = %d with ETag %q", created.ID, w.Code, w.Header().Get("ETag"))
+	}
+	return created.ID, w.Header().Get("ETag")
+}
+
+func problemCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding problem %s: %v", w.Body, err)
+	}
+	return body.Code
+}
+
+func TestCreateSubscription(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		header http.Header
+		status int
+		code   string
+		start  string
+	}{
+		{
+			name:   "created",
+			body:   `{"service_name":"Netflix","price":800,"user_id":"` + aliceID + `","start_date":"2025-07","end_date":"2025-12"}`,
+			status: http.StatusCreated,
+			start:  "2025-07",
+		},
+		{
+			name:   "legacy date format",
+			body:   `{"service_name":"Netflix","price":800,"user_id":"` + aliceID + `","start_date":"2025-07"}`,
+			header: http.Header{HeaderAcceptDateFormat: {"MM-YYYY"}},
+			status: http.StatusCreated,
+			start:  "07-2025",
+		},
+		{
+			name:   "unknown user",
+			body:   `{"service_name":"Netflix","price":800,"user_id":"` + ghostID + `","start_date":"2025-07"}`,
+			status: http.StatusBadRequest,
+			code:   "unknown_user",
+		},
+		{
+			name:   "malformed user id",
+			body:   `{"service_name":"Netflix","price":800,"user_id":"alice","start_date":"2025-07"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "malformed start date",
+			body:   `{"service_name":"Netflix","price":800,"user_id":"` + aliceID + `","start_date":"July 2025"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "end date before start date",
+			body:   `{"service_name":"Netflix","price":800,"user_id":"` + aliceID + `","start_date":"2025-07","end_date":"2025-06"}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSubscriptionRouter(t)
+
+			w := serve(r, http.MethodPost, "/subscriptions", tt.body, tt.header)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.code != "" && problemCode(t, w) != tt.code {
+				t.Errorf("code = %q, want %q", problemCode(t, w), tt.code)
+			}
+			if tt.start != "" {
+				var created model.Subscription
+				if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				if created.StartDate != tt.start {
+					t.Errorf("start_date = %q, want %q", created.StartDate, tt.start)
+				}
+			}
+		})
+	}
+}
+
+func TestGetSubscription(t *testing.T) {
+	r := newSubscriptionRouter(t)
+	id, etag := createFixture(t, r)
+
+	tests := []struct {
+		name   string
+		id     string
+		status int
+		code   string
+	}{
+		{"found", id, http.StatusOK, ""},
+		{"upper case id", strings.ToUpper(id), http.StatusOK, ""},
+		{"missing", ghostID, http.StatusNotFound, ""},
+		{"invalid id", "42", http.StatusBadRequest, "invalid_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/subscriptions/"+tt.id, "", nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.code != "" && problemCode(t, w) != tt.code {
+				t.Errorf("code = %q, want %q", problemCode(t, w), tt.code)
+			}
+			if w.Code == http.StatusOK && w.Header().Get("ETag") != etag {
+				t.Errorf("ETag = %q, want %q", w.Header().Get("ETag"), etag)
+			}
+		})
+	}
+}
+
+func TestUpdateAndDeleteSubscriptionIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		ifMatch func(etag string) string
+		status  int
+	}{
+		{"update without If-Match", http.MethodPut, `{"price":500}`, func(string) string { return "" }, http.StatusOK},
+		{"update with current ETag", http.MethodPut, `{"price":500}`, func(etag string) string { return etag }, http.StatusOK},
+		{"update with stale ETag", http.MethodPut, `{"price":500}`, func(string) string { return `"stale"` }, http.StatusPreconditionFailed},
+		{"update with malformed date", http.MethodPut, `{"end_date":"2025/12"}`, func(string) string { return "" }, http.StatusBadRequest},
+		{"delete with current ETag", http.MethodDelete, "", func(etag string) string { return etag }, http.StatusOK},
+		{"delete with wildcard", http.MethodDelete, "", func(string) string { return "*" }, http.StatusOK},
+		{"delete with stale ETag", http.MethodDelete, "", func(string) string { return `"stale"` }, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSubscriptionRouter(t)
+			id, etag := createFixture(t, r)
+
+			header := http.Header{}
+			if ifMatch := tt.ifMatch(etag); ifMatch != "" {
+				header.Set("If-Match", ifMatch)
+			}
+			w := serve(r, tt.method, "/subscriptions/"+id, tt.body, header)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			after := serve(r, http.MethodGet, "/subscriptions/"+id, "", nil)
+			switch {
+			case tt.status != http.StatusOK:
+				if after.Code != http.StatusOK || after.Header().Get("ETag") != etag {
+					t.Errorf("subscription changed by a rejected %s: %d, ETag %q", tt.method, after.Code, after.Header().Get("ETag"))
+				}
+			case tt.method == http.MethodDelete:
+				if after.Code != http.StatusNotFound {
+					t.Errorf("GET after delete = %d, want 404", after.Code)
+				}
+			default:
+				if after.Header().Get("ETag") == etag {
+					t.Errorf("ETag did not change after update")
+				}
+			}
+		})
+	}
+}
+
+func TestGetSummary(t *testing.T) {
+	r := newSubscriptionRouter(t)
+	for _, body := range []string{
+		`{"service_name":"Yandex Plus","price":400,"user_id":"` + aliceID + `","start_date":"2025-01","end_date":"2025-03"}`,
+		`{"service_name":"Netflix","price":800,"user_id":"` + aliceID + `","start_date":"2025-03"}`,
+	} {
+		if w := serve(r, http.MethodPost, "/subscriptions", body, nil); w.Code != http.StatusCreated {
+			t.Fatalf("POST /subscriptions = %d %s", w.Code, w.Body)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		total  int
+		count  int
+	}{
+		{"whole year", "start_period=2025-01&end_period=2025-12", http.StatusOK, 1200, 2},
+		{"before the second one", "start_period=2025-01&end_period=2025-02", http.StatusOK, 400, 1},
+		{"after the first one ended", "start_period=04-2025&end_period=12-2025", http.StatusOK, 800, 1},
+		{"by service", "service_name=Netflix&start_period=2025-01&end_period=2025-12", http.StatusOK, 800, 1},
+		{"end before start", "start_period=2025-12&end_period=2025-01", http.StatusBadRequest, 0, 0},
+		{"missing end", "start_period=2025-01", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/summary?"+tt.query, "", nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var summary model.SubscriptionSummary
+			if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+				t.Fatalf("decoding summary: %v", err)
+			}
+			if summary.TotalCost != tt.total || summary.Count != tt.count {
+				t.Errorf("summary = %+v, want total %d over %d subscriptions", summary, tt.total, tt.count)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"subscription-service/internal/model"
+	"subscription-service/internal/service"
+)
+
+type TenantHandler struct {
+	service service.TenantService
+}
+
+func NewTenantHandler(service service.TenantService) *TenantHandler {
+	return &TenantHandler{service: service}
+}
+
+// CreateTenant создает арендатора
+// @Summary Создать арендатора
+// @Description Создает арендатора (клиентскую компанию). Доступно только администраторам без привязки к арендатору
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Param input body model.CreateTenantRequest true "Данные арендатора"
+// @Success 201 {object} model.Tenant
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /admin/tenants [post]
+func (h *TenantHandler) CreateTenant(c *gin.Context) {
+	var req model.CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	t, err := h.service.CreateTenant(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, t)
+}
+
+// ListTenants возвращает список арендаторов
+// @Summary Список арендаторов
+// @Description Возвращает всех арендаторов
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.Tenant
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /admin/tenants [get]
+func (h *TenantHandler) ListTenants(c *gin.Context) {
+	tenants, err := h.service.ListTenants(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tenants)
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"subscription-service/internal/model"
+	"subscription-service/internal/service"
+)
+
+type WebhookHandler struct {
+	service service.WebhookService
+}
+
+func NewWebhookHandler(service service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+// CreateWebhook регистрирует webhook
+// @Summary Зарегистрировать webhook
+// @Description Регистрирует endpoint для получения событий подписок. Секрет для проверки подписи возвращается только в этом ответе
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param input body model.CreateWebhookRequest true "Данные webhook"
+// @Success 201 {object} model.CreatedWebhook
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /webhooks [post]
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req model.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	webhook, err := h.service.CreateWebhook(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// ListWebhooks возвращает список webhook
+// @Summary Список webhook
+// @Description Возвращает все зарегистрированные webhook
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.Webhook
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /webhooks [get]
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	webhooks, err := h.service.ListWebhooks(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// GetWebhook получает webhook по ID
+// @Summary Получить webhook
+// @Description Возвращает webhook по его ID
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "ID webhook"
+// @Success 200 {object} model.Webhook
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /webhooks/{id} [get]
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	id := c.Param("id")
+	if !isUUID(id) {
+		invalidID(c, "id")
+		return
+	}
+
+	webhook, err := h.service.GetWebhook(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook удаляет webhook
+// @Summary Удалить webhook
+// @Description Удаляет webhook вместе с журналом доставок
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "ID webhook"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+	if !isUUID(id) {
+		invalidID(c, "id")
+		return
+	}
+
+	if err := h.service.DeleteWebhook(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "webhook deleted successfully"})
+}
+
+// ListDeliveries возвращает журнал доставок webhook
+// @Summary Журнал доставок
+// @Description Возвращает все попытки доставки событий для webhook
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "ID webhook"
+// @Success 200 {array} model.WebhookDelivery
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	id := c.Param("id")
+	if !isUUID(id) {
+		invalidID(c, "id")
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayDelivery повторно отправляет событие
+// @Summary Повторить доставку
+// @Description Ставит в очередь новую доставку с исходным содержимым события
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "ID webhook"
+// @Param delivery_id path string true "ID доставки"
+// @Success 202 {object} model.WebhookDelivery
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Security BearerAuth
+// @Router /webhooks/{id}/deliveries/{delivery_id}/replay [post]
+func (h *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	id := c.Param("id")
+	if !isUUID(id) {
+		invalidID(c, "id")
+		return
+	}
+	deliveryID := c.Param("delivery_id")
+	if !isUUID(deliveryID) {
+		invalidID(c, "delivery_id")
+		return
+	}
+
+	delivery, err := h.service.ReplayDelivery(c.Request.Context(), id, deliveryID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
@@ -0,0 +1,136 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// Check reports a dependency as unhealthy by returning an error.
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type Report struct {
+	Status        string                 `json:"status"`
+	UptimeSeconds *float64               `json:"uptime_seconds,omitempty"`
+	Goroutines    *int                   `json:"goroutines,omitempty"`
+	Checks        map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker serves the liveness and readiness probes. When authorize is set,
+// only callers it accepts get the detailed report, others see the status.
+type Checker struct {
+	checks    []namedCheck
+	timeout   time.Duration
+	authorize func(r *http.Request) bool
+	started   time.Time
+	draining  atomic.Bool
+}
+
+func NewChecker(timeout time.Duration, authorize func(r *http.Request) bool) *Checker {
+	return &Checker{timeout: timeout, authorize: authorize, started: time.Now()}
+}
+
+// Add registers a readiness check, it must be called before serving.
+func (h *Checker) Add(name string, check Check) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Livez reports that the process is up and serving HTTP, it never checks
+// dependencies so a database outage does not get the pod restarted.
+func (h *Checker) Livez(c *gin.Context) {
+	report := Report{Status: StatusOK}
+	if h.showDetails(c.Request) {
+		uptime := time.Since(h.started).Seconds()
+		goroutines := runtime.NumGoroutine()
+		report.UptimeSeconds = &uptime
+		report.Goroutines = &goroutines
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Drain makes the readiness probe fail, so the load balancer stops sending
+// new requests while the server shuts down.
+func (h *Checker) Drain() {
+	h.draining.Store(true)
+}
+
+// Readyz runs all checks concurrently and answers 503 if any of them fails.
+func (h *Checker) Readyz(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, Report{Status: StatusDraining})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	results := make(map[string]CheckResult, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, nc := range h.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := nc.check(ctx)
+			result := CheckResult{
+				Status:     StatusOK,
+				DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[nc.name] = result
+			mu.Unlock()
+		}(nc)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	if h.showDetails(c.Request) {
+		report.Checks = results
+	}
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+func (h *Checker) showDetails(r *http.Request) bool {
+	return h.authorize == nil || h.authorize(r)
+}
@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat tracks the activity of a background worker. The worker beats on
+// every poll and on every processed item.
+type Heartbeat struct {
+	last    atomic.Int64
+	stopped atomic.Bool
+}
+
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+func (h *Heartbeat) Stop() {
+	h.stopped.Store(true)
+}
+
+// Check fails when the worker has not started, has stopped or has shown no
+// activity for longer than staleAfter.
+func (h *Heartbeat) Check(staleAfter time.Duration) Check {
+	return func(ctx context.Context) error {
+		if h.stopped.Load() {
+			return fmt.Errorf("worker stopped")
+		}
+
+		last := h.last.Load()
+		if last == 0 {
+			return fmt.Errorf("worker not started")
+		}
+
+		if idle := time.Since(time.Unix(0, last)); idle > staleAfter {
+			return fmt.Errorf("no activity for %s", idle.Round(time.Second))
+		}
+		return nil
+	}
+}
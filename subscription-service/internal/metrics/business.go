@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"subscription-service/internal/model"
+)
+
+type SubscriptionStatsSource interface {
+	ActiveStats(ctx context.Context) ([]*model.SubscriptionStats, error)
+}
+
+type subscriptionCollector struct {
+	source      SubscriptionStatsSource
+	timeout     time.Duration
+	active      *prometheus.Desc
+	monthlyCost *prometheus.Desc
+}
+
+// NewSubscriptionCollector exposes per-tenant business gauges. They are
+// computed by a single aggregate query on every scrape.
+func NewSubscriptionCollector(source SubscriptionStatsSource) prometheus.Collector {
+	return &subscriptionCollector{
+		source:  source,
+		timeout: 5 * time.Second,
+		active: prometheus.NewDesc(namespace+"_subscriptions_active",
+			"Number of subscriptions active in the current month.", []string{"tenant"}, nil),
+		monthlyCost: prometheus.NewDesc(namespace+"_monthly_recurring_cost",
+			"Total monthly price of subscriptions active in the current month.", []string{"tenant"}, nil),
+	}
+}
+
+func (c *subscriptionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.monthlyCost
+}
+
+func (c *subscriptionCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	stats, err := c.source.ActiveStats(ctx)
+	if err != nil {
+		slog.Error("error collecting subscription metrics", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.active, err)
+		return
+	}
+
+	for _, s := range stats {
+		ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(s.Active), s.TenantID)
+		ch <- prometheus.MustNewConstMetric(c.monthlyCost, prometheus.GaugeValue, float64(s.MonthlyCost), s.TenantID)
+	}
+}
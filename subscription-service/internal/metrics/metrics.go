@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "subscription_service"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of handled HTTP requests.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of repository methods, including transaction overhead.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"repository", "method"})
+
+	summaryCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "summary_cache_requests_total",
+		Help:      "Number of summary requests by cache result, hit or miss.",
+	}, []string{"result"})
+)
+
+// ObserveQuery records the latency of a repository method, meant to be
+// deferred at its start:
+//
+//	defer metrics.ObserveQuery("subscription", "GetByID", time.Now())
+func ObserveQuery(repository, method string, start time.Time) {
+	queryDuration.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+}
+
+// ObserveSummaryCache counts a summary served from the cache or computed.
+func ObserveSummaryCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	summaryCacheRequests.WithLabelValues(result).Inc()
+}
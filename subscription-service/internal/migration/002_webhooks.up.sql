@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    url        TEXT        NOT NULL,
+    secret     VARCHAR(128) NOT NULL,
+    events     TEXT[]      NOT NULL,
+    active     BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    webhook_id      UUID        NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_id        UUID        NOT NULL,
+    event_type      VARCHAR(64) NOT NULL,
+    payload         JSONB       NOT NULL,
+    status          VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    response_status INTEGER,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    delivered_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ      DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,12 @@
+-- Restores the free-form user_id column, remapped IDs get their legacy value
+-- back. Users created by the service itself keep their UUID.
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS fk_subscriptions_user;
+ALTER TABLE subscriptions ALTER COLUMN user_id TYPE VARCHAR(36) USING user_id::text;
+
+UPDATE subscriptions s
+SET user_id = u.legacy_id
+FROM users u
+WHERE s.user_id = u.id::text
+  AND u.legacy_id IS NOT NULL;
+
+DROP TABLE IF EXISTS users;
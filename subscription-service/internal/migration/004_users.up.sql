@@ -0,0 +1,53 @@
+CREATE TABLE IF NOT EXISTS users
+(
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       VARCHAR(255),
+    email      VARCHAR(255) UNIQUE,
+    legacy_id  VARCHAR(36) UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Subscriptions created before the users table reference free-form user IDs.
+-- Every orphan ID gets a user: valid UUIDs are kept as is, anything else is
+-- mapped to a deterministic UUID and the original value is kept in legacy_id.
+DO
+$$
+    DECLARE
+        created  INTEGER;
+        remapped INTEGER;
+    BEGIN
+        IF (SELECT data_type
+            FROM information_schema.columns
+            WHERE table_schema = current_schema()
+              AND table_name = 'subscriptions'
+              AND column_name = 'user_id') = 'uuid' THEN
+            RETURN;
+        END IF;
+
+        INSERT INTO users (id, legacy_id)
+        SELECT DISTINCT md5(user_id)::uuid, user_id
+        FROM subscriptions
+        WHERE user_id !~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$'
+        ON CONFLICT DO NOTHING;
+        GET DIAGNOSTICS remapped = ROW_COUNT;
+
+        UPDATE subscriptions
+        SET user_id = md5(user_id)::uuid::text
+        WHERE user_id !~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$';
+
+        INSERT INTO users (id)
+        SELECT DISTINCT user_id::uuid
+        FROM subscriptions
+        ON CONFLICT DO NOTHING;
+        GET DIAGNOSTICS created = ROW_COUNT;
+
+        RAISE NOTICE 'users migration: created % users for orphan UUIDs, remapped % non-UUID user IDs (see users.legacy_id)',
+            created, remapped;
+
+        ALTER TABLE subscriptions
+            ALTER COLUMN user_id TYPE UUID USING user_id::uuid;
+        ALTER TABLE subscriptions
+            ADD CONSTRAINT fk_subscriptions_user FOREIGN KEY (user_id) REFERENCES users (id);
+    END
+$$;
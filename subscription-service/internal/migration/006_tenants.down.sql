@@ -0,0 +1,28 @@
+-- Merges all tenants back into a single data set. Fails if two tenants have
+-- users with the same email, those have to be resolved by hand first.
+DROP POLICY IF EXISTS tenant_isolation ON subscriptions;
+DROP POLICY IF EXISTS tenant_isolation ON users;
+ALTER TABLE subscriptions NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE subscriptions DISABLE ROW LEVEL SECURITY;
+ALTER TABLE users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS fk_subscriptions_tenant_user;
+
+DROP INDEX IF EXISTS idx_users_tenant_email;
+DROP INDEX IF EXISTS idx_users_tenant_legacy_id;
+DROP INDEX IF EXISTS idx_users_tenant_id;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE webhooks DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE outbox DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE users ADD CONSTRAINT users_legacy_id_key UNIQUE (legacy_id);
+ALTER TABLE subscriptions
+    ADD CONSTRAINT fk_subscriptions_user FOREIGN KEY (user_id) REFERENCES users (id);
+
+DROP TABLE IF EXISTS tenants;
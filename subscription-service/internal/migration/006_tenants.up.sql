@@ -0,0 +1,70 @@
+CREATE TABLE IF NOT EXISTS tenants
+(
+    id         VARCHAR(64) PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO tenants (id, name)
+VALUES ('default', 'Default tenant')
+ON CONFLICT DO NOTHING;
+
+-- Existing rows belong to the default tenant. The default is dropped right
+-- away so that a write without an explicit tenant fails instead of silently
+-- landing in the default tenant.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants (id);
+ALTER TABLE subscriptions ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants (id);
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants (id);
+ALTER TABLE webhooks ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants (id);
+ALTER TABLE webhook_deliveries ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants (id);
+ALTER TABLE outbox ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' REFERENCES tenants (id);
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_tenant_user ON subscriptions (tenant_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_tenant_service ON subscriptions (tenant_id, service_name);
+CREATE INDEX IF NOT EXISTS idx_webhooks_tenant ON webhooks (tenant_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant ON api_keys (tenant_id);
+
+-- Uniqueness of user attributes is per tenant, and a subscription may only
+-- reference a user of its own tenant.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_legacy_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users (tenant_id, email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_legacy_id ON users (tenant_id, legacy_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_id ON users (tenant_id, id);
+
+DO
+$$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_subscriptions_tenant_user') THEN
+            ALTER TABLE subscriptions
+                DROP CONSTRAINT IF EXISTS fk_subscriptions_user;
+            ALTER TABLE subscriptions
+                ADD CONSTRAINT fk_subscriptions_tenant_user FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id);
+        END IF;
+    END
+$$;
+
+-- Row-level security is a second line of defence behind the tenant filter in
+-- every query: the repositories set app.tenant_id for each transaction, and
+-- jobs that legitimately work across tenants set app.bypass_rls. Note that
+-- superusers bypass RLS, the service has to connect as a regular role.
+ALTER TABLE subscriptions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE subscriptions FORCE ROW LEVEL SECURITY;
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON subscriptions;
+CREATE POLICY tenant_isolation ON subscriptions
+    USING (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+
+DROP POLICY IF EXISTS tenant_isolation ON users;
+CREATE POLICY tenant_isolation ON users
+    USING (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.bypass_rls', true) = 'on');
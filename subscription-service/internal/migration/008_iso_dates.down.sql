@@ -0,0 +1,9 @@
+SET LOCAL app.bypass_rls = 'on';
+
+UPDATE subscriptions
+SET start_date = to_char(to_date(start_date, 'YYYY-MM'), 'MM-YYYY')
+WHERE start_date ~ '^\d{4}-\d{2}$';
+
+UPDATE subscriptions
+SET end_date = to_char(to_date(end_date, 'YYYY-MM'), 'MM-YYYY')
+WHERE end_date ~ '^\d{4}-\d{2}$';
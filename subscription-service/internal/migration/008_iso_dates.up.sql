@@ -0,0 +1,20 @@
+-- Subscription dates are stored as YYYY-MM, which unlike MM-YYYY compares
+-- correctly as a string. Dates written before validation existed may also
+-- be DD-MM-YYYY, the day is dropped.
+SET LOCAL app.bypass_rls = 'on';
+
+UPDATE subscriptions
+SET start_date = to_char(to_date(start_date, 'MM-YYYY'), 'YYYY-MM')
+WHERE start_date ~ '^\d{2}-\d{4}$';
+
+UPDATE subscriptions
+SET start_date = to_char(to_date(start_date, 'DD-MM-YYYY'), 'YYYY-MM')
+WHERE start_date ~ '^\d{2}-\d{2}-\d{4}$';
+
+UPDATE subscriptions
+SET end_date = to_char(to_date(end_date, 'MM-YYYY'), 'YYYY-MM')
+WHERE end_date ~ '^\d{2}-\d{4}$';
+
+UPDATE subscriptions
+SET end_date = to_char(to_date(end_date, 'DD-MM-YYYY'), 'YYYY-MM')
+WHERE end_date ~ '^\d{2}-\d{2}-\d{4}$';
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS subscriptions_summary_invalidation ON subscriptions;
+DROP FUNCTION IF EXISTS notify_summary_invalidation();
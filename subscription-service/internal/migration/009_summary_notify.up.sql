@@ -0,0 +1,22 @@
+-- Replicas cache summaries per user. Every change of a subscription notifies
+-- them with "tenant_id:user_id" once the transaction commits, whatever
+-- process made it.
+CREATE OR REPLACE FUNCTION notify_summary_invalidation() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM pg_notify('summary_invalidation', OLD.tenant_id || ':' || OLD.user_id::text);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM pg_notify('summary_invalidation', NEW.tenant_id || ':' || NEW.user_id::text);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS subscriptions_summary_invalidation ON subscriptions;
+CREATE TRIGGER subscriptions_summary_invalidation
+    AFTER INSERT OR UPDATE OR DELETE
+    ON subscriptions
+    FOR EACH ROW
+EXECUTE FUNCTION notify_summary_invalidation();
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS subscriptions_monthly_spend ON subscriptions;
+DROP FUNCTION IF EXISTS maintain_monthly_spend();
+DROP FUNCTION IF EXISTS monthly_spend_add(subscriptions, INTEGER);
+DROP TABLE IF EXISTS rollups;
+DROP TABLE IF EXISTS monthly_spend;
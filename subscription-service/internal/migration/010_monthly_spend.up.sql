@@ -0,0 +1,83 @@
+-- Rollup of subscriptions per user, service and month. A subscription is
+-- counted in started/started_spend of its start month and, if it has an end,
+-- in ended/ended_spend of its end month. The subscriptions active in a period
+-- [from, to] are those started in a month <= to minus those ended in a month
+-- < from (the API keeps end dates not before start dates), so summaries sum
+-- a few rows per user and service instead of every subscription, and
+-- open-ended subscriptions need no rows in the future.
+CREATE TABLE IF NOT EXISTS monthly_spend
+(
+    tenant_id     VARCHAR(64)  NOT NULL REFERENCES tenants (id),
+    user_id       UUID         NOT NULL,
+    service_name  VARCHAR(255) NOT NULL,
+    month         VARCHAR(7)   NOT NULL,
+    started       INTEGER      NOT NULL DEFAULT 0,
+    started_spend BIGINT       NOT NULL DEFAULT 0,
+    ended         INTEGER      NOT NULL DEFAULT 0,
+    ended_spend   BIGINT       NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, user_id, service_name, month)
+);
+
+CREATE INDEX IF NOT EXISTS idx_monthly_spend_tenant_month ON monthly_spend (tenant_id, month);
+
+ALTER TABLE monthly_spend ENABLE ROW LEVEL SECURITY;
+ALTER TABLE monthly_spend FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON monthly_spend;
+CREATE POLICY tenant_isolation ON monthly_spend
+    USING (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.bypass_rls', true) = 'on')
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.bypass_rls', true) = 'on');
+
+-- The rollup is maintained from now on but starts empty: building it for
+-- every existing subscription would hold the migration lock for as long as
+-- that takes. Queries read it only once "rollup rebuild" marked it fresh.
+CREATE TABLE IF NOT EXISTS rollups
+(
+    name       VARCHAR(64) PRIMARY KEY,
+    fresh      BOOLEAN     NOT NULL DEFAULT FALSE,
+    rebuilt_at TIMESTAMPTZ
+);
+
+INSERT INTO rollups (name)
+VALUES ('monthly_spend')
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION monthly_spend_add(sub subscriptions, sign INTEGER) RETURNS VOID AS
+$$
+BEGIN
+    INSERT INTO monthly_spend (tenant_id, user_id, service_name, month, started, started_spend)
+    VALUES (sub.tenant_id, sub.user_id, sub.service_name, sub.start_date, sign, sign * sub.price)
+    ON CONFLICT (tenant_id, user_id, service_name, month) DO UPDATE
+        SET started       = monthly_spend.started + EXCLUDED.started,
+            started_spend = monthly_spend.started_spend + EXCLUDED.started_spend;
+
+    IF sub.end_date IS NOT NULL THEN
+        INSERT INTO monthly_spend (tenant_id, user_id, service_name, month, ended, ended_spend)
+        VALUES (sub.tenant_id, sub.user_id, sub.service_name, sub.end_date, sign, sign * sub.price)
+        ON CONFLICT (tenant_id, user_id, service_name, month) DO UPDATE
+            SET ended       = monthly_spend.ended + EXCLUDED.ended,
+                ended_spend = monthly_spend.ended_spend + EXCLUDED.ended_spend;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- The rollup changes in the transaction of the subscription write.
+CREATE OR REPLACE FUNCTION maintain_monthly_spend() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM monthly_spend_add(OLD, -1);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM monthly_spend_add(NEW, 1);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS subscriptions_monthly_spend ON subscriptions;
+CREATE TRIGGER subscriptions_monthly_spend
+    AFTER INSERT OR UPDATE OF tenant_id, user_id, service_name, price, start_date, end_date OR DELETE
+    ON subscriptions
+    FOR EACH ROW
+EXECUTE FUNCTION maintain_monthly_spend();
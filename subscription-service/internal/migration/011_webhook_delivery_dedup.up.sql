@@ -0,0 +1,16 @@
+-- The outbox retries an event until every publisher accepts it, so the
+-- webhook publisher sees the same event more than once. Each webhook gets one
+-- delivery per event, replays are recorded as separate deliveries pointing
+-- at the replayed one.
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS replay_of UUID;
+
+UPDATE webhook_deliveries d
+SET replay_of = first.id
+FROM (SELECT DISTINCT ON (webhook_id, event_id) id, webhook_id, event_id
+      FROM webhook_deliveries
+      ORDER BY webhook_id, event_id, created_at, id) first
+WHERE d.webhook_id = first.webhook_id
+  AND d.event_id = first.event_id
+  AND d.id <> first.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id) WHERE replay_of IS NULL;
@@ -0,0 +1,13 @@
+DROP POLICY IF EXISTS tenant_isolation ON api_keys;
+DROP POLICY IF EXISTS tenant_isolation ON outbox;
+DROP POLICY IF EXISTS tenant_isolation ON webhook_deliveries;
+DROP POLICY IF EXISTS tenant_isolation ON webhooks;
+
+ALTER TABLE api_keys NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE api_keys DISABLE ROW LEVEL SECURITY;
+ALTER TABLE outbox NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE outbox DISABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries DISABLE ROW LEVEL SECURITY;
+ALTER TABLE webhooks NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE webhooks DISABLE ROW LEVEL SECURITY;
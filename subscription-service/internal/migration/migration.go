@@ -0,0 +1,9 @@
+// Package migration embeds the SQL migrations. Files are named
+// NNN_name.up.sql and NNN_name.down.sql, versions are applied in order by
+// database.Migrator.
+package migration
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
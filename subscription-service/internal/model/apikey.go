@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type APIKey struct {
+	ID          string         `json:"id" db:"id"`
+	TenantID    string         `json:"tenant_id" db:"tenant_id"`
+	Name        string         `json:"name" db:"name"`
+	Prefix      string         `json:"prefix" db:"prefix"`
+	KeyHash     string         `json:"-" db:"key_hash"`
+	Scopes      pq.StringArray `json:"scopes" db:"scopes" swaggertype:"array,string"`
+	RotatedFrom *string        `json:"rotated_from,omitempty" db:"rotated_from"`
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt   *time.Time     `json:"revoked_at,omitempty" db:"revoked_at"`
+	LastUsedAt  *time.Time     `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+}
+
+// IssuedAPIKey carries the plaintext key, it is returned only when a key is
+// issued or rotated and is never stored.
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=255"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=subscriptions:read subscriptions:write summary:read admin"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
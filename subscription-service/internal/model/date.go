@@ -0,0 +1,51 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// MonthLayout is the canonical format of subscription dates and summary
+	// periods. Dates are stored and returned in it, and it sorts correctly
+	// as a string.
+	MonthLayout = "2006-01"
+
+	// LegacyMonthLayout is the format dates were returned in before, clients
+	// can still ask for it with the Accept-Date-Format header.
+	LegacyMonthLayout = "01-2006"
+)
+
+// monthInputLayouts are the accepted input formats. Subscriptions are billed
+// monthly, so the day of a full date is dropped on normalization.
+var monthInputLayouts = []string{MonthLayout, "2006-01-02", LegacyMonthLayout, "02-01-2006"}
+
+// ParseMonth parses a date in any accepted format and returns the first day
+// of its month.
+func ParseMonth(s string) (time.Time, error) {
+	for _, layout := range monthInputLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// NormalizeMonth converts a date in any accepted format to MonthLayout.
+func NormalizeMonth(s string) (string, error) {
+	t, err := ParseMonth(s)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(MonthLayout), nil
+}
+
+// FormatMonth converts a normalized date to layout. Values that are not
+// normalized are returned unchanged.
+func FormatMonth(s, layout string) string {
+	t, err := time.Parse(MonthLayout, s)
+	if err != nil {
+		return s
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventSubscriptionCreated = "subscription.created"
+	EventSubscriptionUpdated = "subscription.updated"
+	EventSubscriptionDeleted = "subscription.deleted"
+)
+
+const AggregateSubscription = "subscription"
+
+// OutboxMessage is a domain event stored in the same transaction as the
+// change that produced it and published later by the outbox relay.
+type OutboxMessage struct {
+	ID            string          `db:"id"`
+	TenantID      string          `db:"tenant_id"`
+	AggregateType string          `db:"aggregate_type"`
+	AggregateID   string          `db:"aggregate_id"`
+	EventType     string          `db:"event_type"`
+	SchemaVersion string          `db:"schema_version"`
+	Payload       json.RawMessage `db:"payload"`
+	Attempts      int             `db:"attempts"`
+	LastError     *string         `db:"last_error"`
+	NextAttemptAt time.Time       `db:"next_attempt_at"`
+	PublishedAt   *time.Time      `db:"published_at"`
+	CreatedAt     time.Time       `db:"created_at"`
+}
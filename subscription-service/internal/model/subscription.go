@@ -1,11 +1,13 @@
 package model
 
 import (
+	"strconv"
 	"time"
 )
 
 type Subscription struct {
 	ID          string    `json:"id" db:"id"`
+	TenantID    string    `json:"tenant_id" db:"tenant_id"`
 	ServiceName string    `json:"service_name" db:"service_name"`
 	Price       int       `json:"price" db:"price"`
 	UserID      string    `json:"user_id" db:"user_id"`
@@ -15,19 +17,35 @@ type Subscription struct {
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// ETag identifies the current version of the subscription, every update
+// bumps updated_at.
+func (s *Subscription) ETag() string {
+	return `"` + strconv.FormatInt(s.UpdatedAt.UnixNano(), 36) + `"`
+}
+
 type CreateSubscriptionRequest struct {
-	ServiceName string  `json:"service_name" binding:"required"`
-	Price       int     `json:"price" binding:"required,min=0"`
-	UserID      string  `json:"user_id" binding:"required"`
-	StartDate   string  `json:"start_date" binding:"required"`
-	EndDate     *string `json:"end_date,omitempty"`
+	ServiceName string  `json:"service_name" binding:"required,max=255"`
+	Price       int     `json:"price" binding:"required,min=0,max=1000000"`
+	UserID      string  `json:"user_id" binding:"required,uuid"`
+	StartDate   string  `json:"start_date" binding:"required,month"`
+	EndDate     *string `json:"end_date,omitempty" binding:"omitempty,month,notbefore=StartDate"`
 }
 
 type UpdateSubscriptionRequest struct {
-	ServiceName *string `json:"service_name,omitempty"`
-	Price       *int    `json:"price,omitempty"`
-	StartDate   *string `json:"start_date,omitempty"`
-	EndDate     *string `json:"end_date,omitempty"`
+	ServiceName *string `json:"service_name,omitempty" binding:"omitempty,min=1,max=255"`
+	Price       *int    `json:"price,omitempty" binding:"omitempty,min=0,max=1000000"`
+	StartDate   *string `json:"start_date,omitempty" binding:"omitempty,month"`
+	EndDate     *string `json:"end_date,omitempty" binding:"omitempty,month,notbefore=StartDate"`
+}
+
+// Normalize converts the dates of the request to MonthLayout.
+func (r *CreateSubscriptionRequest) Normalize() error {
+	return normalizeMonths(&r.StartDate, r.EndDate)
+}
+
+// Normalize converts the dates of the request to MonthLayout.
+func (r *UpdateSubscriptionRequest) Normalize() error {
+	return normalizeMonths(r.StartDate, r.EndDate)
 }
 
 type SubscriptionSummary struct {
@@ -36,8 +54,35 @@ type SubscriptionSummary struct {
 }
 
 type SummaryRequest struct {
-	UserID      *string `form:"user_id"`
-	ServiceName *string `form:"service_name"`
-	StartPeriod string  `form:"start_period" binding:"required"`
-	EndPeriod   string  `form:"end_period" binding:"required"`
+	UserID      *string `form:"user_id" binding:"omitempty,uuid"`
+	ServiceName *string `form:"service_name" binding:"omitempty,max=255"`
+	StartPeriod string  `form:"start_period" binding:"required,month"`
+	EndPeriod   string  `form:"end_period" binding:"required,month,notbefore=StartPeriod"`
+}
+
+// Normalize converts the periods of the request to MonthLayout.
+func (r *SummaryRequest) Normalize() error {
+	return normalizeMonths(&r.StartPeriod, &r.EndPeriod)
+}
+
+// SubscriptionStats describes the subscriptions of a tenant that are active
+// in the current month.
+type SubscriptionStats struct {
+	TenantID    string `db:"tenant_id"`
+	Active      int    `db:"active"`
+	MonthlyCost int64  `db:"monthly_cost"`
+}
+
+func normalizeMonths(dates ...*string) error {
+	for _, date := range dates {
+		if date == nil {
+			continue
+		}
+		normalized, err := NormalizeMonth(*date)
+		if err != nil {
+			return err
+		}
+		*date = normalized
+	}
+	return nil
 }
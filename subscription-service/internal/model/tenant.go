@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+type Tenant struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type CreateTenantRequest struct {
+	ID   string `json:"id" binding:"required,max=64"`
+	Name string `json:"name" binding:"required,max=255"`
+}
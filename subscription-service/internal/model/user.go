@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+type User struct {
+	ID        string    `json:"id" db:"id"`
+	TenantID  string    `json:"tenant_id" db:"tenant_id"`
+	Name      *string   `json:"name,omitempty" db:"name"`
+	Email     *string   `json:"email,omitempty" db:"email"`
+	LegacyID  *string   `json:"legacy_id,omitempty" db:"legacy_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type CreateUserRequest struct {
+	ID    *string `json:"id,omitempty" binding:"omitempty,uuid"`
+	Name  *string `json:"name,omitempty" binding:"omitempty,max=255"`
+	Email *string `json:"email,omitempty" binding:"omitempty,email,max=255"`
+}
+
+type UpdateUserRequest struct {
+	Name  *string `json:"name,omitempty" binding:"omitempty,max=255"`
+	Email *string `json:"email,omitempty" binding:"omitempty,email,max=255"`
+}
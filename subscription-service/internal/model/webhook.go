@@ -0,0 +1,56 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+type Webhook struct {
+	ID        string         `json:"id" db:"id"`
+	TenantID  string         `json:"tenant_id" db:"tenant_id"`
+	URL       string         `json:"url" db:"url"`
+	Secret    string         `json:"-" db:"secret"`
+	Events    pq.StringArray `json:"events" db:"events" swaggertype:"array,string"`
+	Active    bool           `json:"active" db:"active"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// CreatedWebhook is returned only once on registration, it is the single
+// place where the signing secret is exposed to the integrator.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,http_url"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=subscription.created subscription.updated subscription.deleted"`
+	Secret string   `json:"secret,omitempty" binding:"omitempty,min=16,max=128"`
+}
+
+type WebhookDelivery struct {
+	ID             string          `json:"id" db:"id"`
+	TenantID       string          `json:"tenant_id" db:"tenant_id"`
+	WebhookID      string          `json:"webhook_id" db:"webhook_id"`
+	EventID        string          `json:"event_id" db:"event_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	ReplayOf       *string         `json:"replay_of,omitempty" db:"replay_of"`
+	Payload        json.RawMessage `json:"payload" db:"payload" swaggertype:"object"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty" db:"response_status"`
+	LastError      *string         `json:"last_error,omitempty" db:"last_error"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at" db:"updated_at"`
+}
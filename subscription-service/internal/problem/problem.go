@@ -0,0 +1,44 @@
+package problem
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"subscription-service/internal/apperror"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object. Code is a stable identifier
+// of the error that clients can switch on, Detail is for humans and may
+// change. Errors lists the offending fields of a validation error.
+type Problem struct {
+	Type     string `json:"type" example:"about:blank"`
+	Title    string `json:"title" example:"Not Found"`
+	Status   int    `json:"status" example:"404"`
+	Detail   string `json:"detail,omitempty" example:"subscription not found"`
+	Instance string `json:"instance,omitempty" example:"/api/v1/subscriptions/60601fee-2bf1-4721-ae6f-7636e79a0cba"`
+	Code     string `json:"code" example:"subscription_not_found"`
+
+	Errors []apperror.FieldError `json:"errors,omitempty"`
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Abort writes the problem as the response and stops the handler chain.
+func Abort(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	// render.JSON keeps a Content-Type that is already set.
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
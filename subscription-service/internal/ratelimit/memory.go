@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+type memoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	idleTTL   time.Duration
+	lastSweep time.Time
+}
+
+// NewMemoryLimiter keeps the buckets in process, so every replica enforces
+// its own limits. Buckets idle for longer than idleTTL are dropped.
+func NewMemoryLimiter(idleTTL time.Duration) Limiter {
+	return &memoryLimiter{
+		buckets:   make(map[string]*bucket),
+		idleTTL:   idleTTL,
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *memoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.idleTTL > 0 && now.Sub(l.lastSweep) > l.idleTTL {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updatedAt).Seconds()*limit.Rate)
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return result(limit, b.tokens, false), nil
+	}
+	b.tokens--
+	return result(limit, b.tokens, true), nil
+}
+
+func (l *memoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.updatedAt) > l.idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"subscription-service/internal/problem"
+	"subscription-service/internal/tenant"
+)
+
+// Middleware limits a route group. Clients are identified by API key, then by
+// authenticated user, then by IP address, and get a separate bucket per group.
+// A zero limit disables the middleware.
+func Middleware(limiter Limiter, group string, limit Limit) gin.HandlerFunc {
+	return middleware(limiter, group, limit, tenant.ClientKey)
+}
+
+// ByIP is Middleware identifying clients by IP address only, for use before
+// authentication.
+func ByIP(limiter Limiter, group string, limit Limit) gin.HandlerFunc {
+	return middleware(limiter, group, limit, func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	})
+}
+
+func middleware(limiter Limiter, group string, limit Limit, clientKey func(*gin.Context) string) gin.HandlerFunc {
+	if limit.Rate <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	return func(c *gin.Context) {
+		key := group + ":" + clientKey(c)
+
+		res, err := limiter.Allow(c.Request.Context(), key, limit)
+		if err != nil {
+			// An unavailable limiter must not take the API down with it.
+			slog.ErrorContext(c.Request.Context(), "error checking rate limit", "key", key, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+
+		if !res.Allowed {
+			retryAfter := int(math.Ceil(res.RetryAfter.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			problem.Abort(c, problem.New(http.StatusTooManyRequests, "rate_limited", "rate limit exceeded"))
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type postgresLimiter struct {
+	db      *sqlx.DB
+	idleTTL time.Duration
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresLimiter keeps the buckets in the rate_limit_buckets table, so the
+// limits hold across all replicas sharing the database.
+func NewPostgresLimiter(db *sqlx.DB, idleTTL time.Duration) Limiter {
+	return &postgresLimiter{db: db, idleTTL: idleTTL, lastSweep: time.Now()}
+}
+
+// Allow refills and takes a token in a single upsert. The row lock taken by
+// ON CONFLICT DO UPDATE serializes concurrent requests for the same key.
+// Keys are stored hashed, they contain client supplied identifiers of any
+// length.
+func (l *postgresLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	query := `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+		VALUES ($1, $3::float8 - 1, true, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET (tokens, allowed, updated_at) = (
+			SELECT CASE WHEN refill >= 1 THEN refill - 1 ELSE refill END, refill >= 1, CURRENT_TIMESTAMP
+			FROM (
+				SELECT LEAST($3::float8,
+					b.tokens + EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at)::float8 * $2::float8) AS refill
+			) r
+		)
+		RETURNING tokens, allowed
+	`
+
+	l.maybeSweep()
+
+	var tokens float64
+	var allowed bool
+	hash := sha256.Sum256([]byte(key))
+	err := l.db.QueryRowContext(ctx, query, hex.EncodeToString(hash[:]), limit.Rate, limit.Burst).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(limit, tokens, allowed), nil
+}
+
+func (l *postgresLimiter) maybeSweep() {
+	l.mu.Lock()
+	if l.idleTTL <= 0 || time.Since(l.lastSweep) < l.idleTTL {
+		l.mu.Unlock()
+		return
+	}
+	l.lastSweep = time.Now()
+	l.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		query := `DELETE FROM rate_limit_buckets WHERE updated_at < CURRENT_TIMESTAMP - make_interval(secs => $1)`
+		if _, err := l.db.ExecContext(ctx, query, l.idleTTL.Seconds()); err != nil {
+			slog.Error("error removing idle rate limit buckets", "error", err)
+		}
+	}()
+}
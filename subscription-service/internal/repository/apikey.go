@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/metrics"
+	"subscription-service/internal/model"
+	"subscription-service/internal/tenant"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	GetByID(ctx context.Context, id string) (*model.APIKey, error)
+	GetByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	List(ctx context.Context) ([]*model.APIKey, error)
+	Rotate(ctx context.Context, oldID string, oldExpiresAt time.Time, key *model.APIKey) error
+	Revoke(ctx context.Context, id string) error
+	TouchLastUsed(ctx context.Context, id string) error
+}
+
+var errAPIKeyNotFound = apperror.NotFound("api_key_not_found", "api key not found")
+
+type apiKeyRepo struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepository(db *sqlx.DB) APIKeyRepository {
+	return &apiKeyRepo{db: db}
+}
+
+func insertAPIKey(ctx context.Context, tx *sqlx.Tx, key *model.APIKey) error {
+	query := `
+		INSERT INTO api_keys (tenant_id, name, prefix, key_hash, scopes, rotated_from, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, tenant_id, created_at
+	`
+
+	return tx.QueryRowContext(ctx, query,
+		tenant.FromContext(ctx),
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		key.Scopes,
+		key.RotatedFrom,
+		key.ExpiresAt,
+	).Scan(&key.ID, &key.TenantID, &key.CreatedAt)
+}
+
+func (r *apiKeyRepo) Create(ctx context.Context, key *model.APIKey) error {
+	defer metrics.ObserveQuery("apikey", "Create", time.Now())
+
+	slog.DebugContext(ctx, "inserting API key", "name", key.Name, "prefix", key.Prefix, "scopes", key.Scopes)
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return insertAPIKey(ctx, tx, key)
+	})
+}
+
+func (r *apiKeyRepo) GetByID(ctx context.Context, id string) (*model.APIKey, error) {
+	defer metrics.ObserveQuery("apikey", "GetByID", time.Now())
+
+	query := `SELECT * FROM api_keys WHERE id = $1 AND tenant_id = $2`
+
+	var key model.APIKey
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &key, query, id, tenant.FromContext(ctx))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	return &key, nil
+}
+
+// GetByHash looks the key up across all tenants, the tenant of the request is
+// only known once the key is resolved.
+func (r *apiKeyRepo) GetByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	defer metrics.ObserveQuery("apikey", "GetByHash", time.Now())
+
+	query := `SELECT * FROM api_keys WHERE key_hash = $1`
+
+	var key model.APIKey
+	err := acrossTenants(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &key, query, hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (r *apiKeyRepo) List(ctx context.Context) ([]*model.APIKey, error) {
+	defer metrics.ObserveQuery("apikey", "List", time.Now())
+
+	query := `SELECT * FROM api_keys WHERE tenant_id = $1 ORDER BY created_at DESC`
+
+	var keys []*model.APIKey
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &keys, query, tenant.FromContext(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Rotate stores the replacement key and shortens the lifetime of the old one
+// in a single transaction.
+func (r *apiKeyRepo) Rotate(ctx context.Context, oldID string, oldExpiresAt time.Time, key *model.APIKey) error {
+	defer metrics.ObserveQuery("apikey", "Rotate", time.Now())
+
+	slog.DebugContext(ctx, "rotating API key", "api_key_id", oldID)
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE api_keys
+			SET expires_at = LEAST(COALESCE(expires_at, $1), $1)
+			WHERE id = $2 AND tenant_id = $3 AND revoked_at IS NULL
+		`, oldExpiresAt, oldID, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			return errAPIKeyNotFound
+		}
+
+		return insertAPIKey(ctx, tx, key)
+	})
+}
+
+func (r *apiKeyRepo) Revoke(ctx context.Context, id string) error {
+	defer metrics.ObserveQuery("apikey", "Revoke", time.Now())
+
+	query := `UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL`
+
+	slog.DebugContext(ctx, "revoking API key", "api_key_id", id)
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			return errAPIKeyNotFound
+		}
+		return nil
+	})
+}
+
+// TouchLastUsed updates last_used_at at most once a minute per key to keep
+// authentication from turning every request into a write. Like GetByHash it
+// runs before the tenant of the request is known.
+func (r *apiKeyRepo) TouchLastUsed(ctx context.Context, id string) error {
+	defer metrics.ObserveQuery("apikey", "TouchLastUsed", time.Now())
+
+	query := `
+		UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	`
+
+	return acrossTenants(ctx, r.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query, id)
+		return err
+	})
+}
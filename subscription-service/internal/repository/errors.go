@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+	"subscription-service/internal/apperror"
+)
+
+// Postgres error codes a client can provoke with its input.
+const (
+	pqInvalidTextRepresentation = "22P02"
+	pqInvalidDatetimeFormat     = "22007"
+	pqDatetimeFieldOverflow     = "22008"
+	pqStringDataRightTruncation = "22001"
+	pqNotNullViolation          = "23502"
+	pqForeignKeyViolation       = "23503"
+	pqUniqueViolation           = "23505"
+	pqCheckViolation            = "23514"
+)
+
+// dbError translates Postgres errors caused by client input into domain
+// errors. The original error stays the cause for logs, its text never
+// reaches the client. Domain errors and everything else pass through.
+func dbError(err error) error {
+	var appErr *apperror.Error
+	if err == nil || errors.As(err, &appErr) {
+		return err
+	}
+
+	switch pqCode(err) {
+	case pqInvalidTextRepresentation, pqInvalidDatetimeFormat, pqDatetimeFieldOverflow:
+		return apperror.Wrap(apperror.ErrValidation, "invalid_value", "malformed value", err)
+	case pqStringDataRightTruncation:
+		return apperror.Wrap(apperror.ErrValidation, "value_too_long", "value is too long", err)
+	case pqNotNullViolation, pqCheckViolation:
+		return apperror.Wrap(apperror.ErrValidation, "constraint_violation", "value violates a constraint", err)
+	case pqForeignKeyViolation:
+		return apperror.Wrap(apperror.ErrConflict, "reference_violation", "resource references or is referenced by another resource", err)
+	case pqUniqueViolation:
+		return apperror.Wrap(apperror.ErrConflict, "already_exists", "resource already exists", err)
+	}
+	return err
+}
+
+func pqCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	return ""
+}
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// FileStore is a MemoryStore persisted to an append-only log of JSON
+// records, one change per line. Every change is fsynced before it is applied,
+// so an acknowledged write survives a crash. The log is compacted on open and
+// every compactInterval by writing the current state to a temporary file that
+// replaces the log with a rename. Only one process may use the log at a
+// time, it is guarded by an exclusive lock on path.lock.
+type FileStore struct {
+	*MemoryStore
+
+	path    string
+	lock    *os.File
+	file    *os.File
+	records int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenFileStore replays the log at path, creating it if needed. It fails if
+// another process has the log open. A zero compactInterval compacts only on
+// open.
+func OpenFileStore(path string, compactInterval time.Duration) (_ *FileStore, err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	lock, err := lockLog(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.Close()
+		}
+	}()
+
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+		lock:        lock,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.journal = s
+
+	if err := s.Compact(); err != nil {
+		return nil, err
+	}
+
+	go s.run(compactInterval)
+	return s, nil
+}
+
+// lockLog takes an exclusive lock on the lock file of the log at path, which
+// lasts until the returned file is closed or the process exits. The log
+// itself is not locked because compaction replaces it.
+func lockLog(path string) (*os.File, error) {
+	file, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage lock: %w", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("storage log %s is in use by another process", path)
+		}
+		return nil, fmt.Errorf("failed to lock storage log: %w", err)
+	}
+	return file, nil
+}
+
+// load replays the log. A last line without a newline is a write torn by a
+// crash: it was never acknowledged and is truncated.
+func (s *FileStore) load() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open storage log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(data) == 0 {
+				return nil
+			}
+			slog.Warn("dropping incomplete record at the end of the storage log", "path", s.path, "line", line)
+			if err := os.Truncate(s.path, offset); err != nil {
+				return fmt.Errorf("failed to truncate storage log: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read storage log: %w", err)
+		}
+
+		var rec storeRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("corrupt storage log %s at line %d: %w", s.path, line, err)
+		}
+		if err := s.replay(&rec); err != nil {
+			return fmt.Errorf("corrupt storage log %s at line %d: %w", s.path, line, err)
+		}
+		s.records++
+		offset += int64(len(data))
+	}
+}
+
+// append implements journal, it is called with mu held for writing.
+func (s *FileStore) append(rec *storeRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to write storage log: %w", err)
+	}
+	// A failed write must not leave a partial line for the next one to be
+	// appended to.
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		s.file.Truncate(info.Size())
+		return fmt.Errorf("failed to write storage log: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		s.file.Truncate(info.Size())
+		return fmt.Errorf("failed to sync storage log: %w", err)
+	}
+	s.records++
+	return nil
+}
+
+// Compact rewrites the log with one record per user and subscription. It is
+// a no-op when the log has nothing but those.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var live []*storeRecord
+	for tenantID, users := range s.users {
+		for _, user := range users {
+			live = append(live, &storeRecord{Op: opPutUser, TenantID: tenantID, User: user})
+		}
+	}
+	// Subscriptions reference users, they go after all users.
+	for tenantID, subscriptions := range s.subscriptions {
+		for _, sub := range subscriptions {
+			live = append(live, &storeRecord{Op: opPutSubscription, TenantID: tenantID, Subscription: sub})
+		}
+	}
+	if s.records == len(live) && s.file != nil {
+		return nil
+	}
+
+	if s.records != len(live) {
+		if err := s.writeSnapshot(live); err != nil {
+			return fmt.Errorf("failed to compact storage log: %w", err)
+		}
+		slog.Debug("storage log compacted", "path", s.path, "records", s.records, "live", len(live))
+	}
+
+	// The log file was replaced, appends go to the new one.
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open storage log: %w", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.records = len(live)
+	return nil
+}
+
+// writeSnapshot writes records to a temporary file next to the log and
+// renames it over the log, so a crash leaves either the old or the new log.
+func (s *FileStore) writeSnapshot(records []*storeRecord) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, rec := range records {
+		if err := encoder.Encode(rec); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(s.path))
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (s *FileStore) run(compactInterval time.Duration) {
+	defer close(s.done)
+	if compactInterval <= 0 {
+		<-s.stop
+		return
+	}
+
+	ticker := time.NewTicker(compactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Compact(); err != nil {
+				slog.Error("error compacting storage log", "path", s.path, "error", err)
+			}
+		}
+	}
+}
+
+// Close stops the compaction, closes the log and releases its lock, the store
+// must not be used afterwards.
+func (s *FileStore) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.file.Close()
+	s.lock.Close()
+	return err
+}
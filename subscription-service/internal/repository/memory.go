@@ -0,0 +1,578 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/model"
+	"subscription-service/internal/tenant"
+)
+
+// uuidPattern mirrors what Postgres accepts for UUID columns.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+
+// canonicalUUID returns id the way Postgres stores and returns it, in lower
+// case with dashes, and false if Postgres would reject it.
+func canonicalUUID(id string) (string, bool) {
+	if !uuidPattern.MatchString(id) {
+		return "", false
+	}
+	hex := strings.ToLower(strings.ReplaceAll(id, "-", ""))
+	return hex[:8] + "-" + hex[8:12] + "-" + hex[12:16] + "-" + hex[16:20] + "-" + hex[20:], true
+}
+
+var errMalformedValue = apperror.Validation("invalid_value", "malformed value")
+
+// MemoryStore keeps users and subscriptions in memory, partitioned by tenant
+// like the tables. It is shared by the memory repositories so that
+// references between users and subscriptions are enforced as by the foreign
+// keys. No events are written, and nothing survives a restart unless the
+// store is backed by a FileStore.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	users         map[string]map[string]*model.User
+	subscriptions map[string]map[string]*model.Subscription
+	journal       journal
+}
+
+// journal persists a change of the store before it is applied.
+type journal interface {
+	append(rec *storeRecord) error
+}
+
+const (
+	opPutUser            = "put_user"
+	opDeleteUser         = "delete_user"
+	opPutSubscription    = "put_subscription"
+	opDeleteSubscription = "delete_subscription"
+	opBatch              = "batch"
+)
+
+// storeRecord is a single change of a MemoryStore, puts carry the whole
+// entity and deletes only its id. A batch carries changes that are journaled
+// and applied together.
+type storeRecord struct {
+	Op           string              `json:"op"`
+	TenantID     string              `json:"tenant_id"`
+	ID           string              `json:"id,omitempty"`
+	User         *model.User         `json:"user,omitempty"`
+	Subscription *model.Subscription `json:"subscription,omitempty"`
+	Records      []*storeRecord      `json:"records,omitempty"`
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:         make(map[string]map[string]*model.User),
+		subscriptions: make(map[string]map[string]*model.Subscription),
+	}
+}
+
+// tenantUsers and tenantSubscriptions must be called with mu held for writing
+// when the result is modified.
+func (s *MemoryStore) tenantUsers(tenantID string) map[string]*model.User {
+	users, ok := s.users[tenantID]
+	if !ok {
+		users = make(map[string]*model.User)
+		s.users[tenantID] = users
+	}
+	return users
+}
+
+func (s *MemoryStore) tenantSubscriptions(tenantID string) map[string]*model.Subscription {
+	subscriptions, ok := s.subscriptions[tenantID]
+	if !ok {
+		subscriptions = make(map[string]*model.Subscription)
+		s.subscriptions[tenantID] = subscriptions
+	}
+	return subscriptions
+}
+
+// apply journals rec and applies it, mu must be held for writing.
+func (s *MemoryStore) apply(rec *storeRecord) error {
+	if s.journal != nil {
+		if err := s.journal.append(rec); err != nil {
+			return err
+		}
+	}
+	return s.replay(rec)
+}
+
+// applyAll journals recs as one batch record, so that they are persisted
+// and applied all or none, and applies them. mu must be held for writing.
+func (s *MemoryStore) applyAll(recs []*storeRecord) error {
+	switch len(recs) {
+	case 0:
+		return nil
+	case 1:
+		return s.apply(recs[0])
+	default:
+		return s.apply(&storeRecord{Op: opBatch, Records: recs})
+	}
+}
+
+func (s *MemoryStore) replay(rec *storeRecord) error {
+	switch rec.Op {
+	case opBatch:
+		for _, r := range rec.Records {
+			if err := s.replay(r); err != nil {
+				return err
+			}
+		}
+	case opPutUser:
+		s.tenantUsers(rec.TenantID)[rec.User.ID] = rec.User
+	case opDeleteUser:
+		delete(s.users[rec.TenantID], rec.ID)
+	case opPutSubscription:
+		s.tenantSubscriptions(rec.TenantID)[rec.Subscription.ID] = rec.Subscription
+	case opDeleteSubscription:
+		delete(s.subscriptions[rec.TenantID], rec.ID)
+	default:
+		return fmt.Errorf("unknown storage operation %q", rec.Op)
+	}
+	return nil
+}
+
+type memorySubscriptionRepo struct {
+	store *MemoryStore
+}
+
+func NewMemorySubscriptionRepository(store *MemoryStore) SubscriptionRepository {
+	return &memorySubscriptionRepo{store: store}
+}
+
+func (r *memorySubscriptionRepo) Create(ctx context.Context, sub *model.Subscription) error {
+	return r.CreateMany(ctx, []*model.Subscription{sub})
+}
+
+// CreateMany checks the references of all subscriptions before creating any.
+func (r *memorySubscriptionRepo) CreateMany(ctx context.Context, subs []*model.Subscription) error {
+	for _, sub := range subs {
+		userID, ok := canonicalUUID(sub.UserID)
+		if !ok {
+			return errMalformedValue
+		}
+		sub.UserID = userID
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+	users := r.store.tenantUsers(tenantID)
+	for _, sub := range subs {
+		if _, ok := users[sub.UserID]; !ok {
+			return apperror.Conflict("reference_violation", "resource references or is referenced by another resource")
+		}
+	}
+
+	now := time.Now().UTC()
+	recs := make([]*storeRecord, 0, len(subs))
+	for _, sub := range subs {
+		sub.ID = uuid.NewString()
+		sub.TenantID = tenantID
+		sub.CreatedAt = now
+		sub.UpdatedAt = now
+		recs = append(recs, &storeRecord{Op: opPutSubscription, TenantID: tenantID, Subscription: copySubscription(sub)})
+	}
+	return r.store.applyAll(recs)
+}
+
+func (r *memorySubscriptionRepo) GetByID(ctx context.Context, id string) (*model.Subscription, error) {
+	id, ok := canonicalUUID(id)
+	if !ok {
+		return nil, errMalformedValue
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	sub, ok := r.store.subscriptions[tenant.FromContext(ctx)][id]
+	if !ok {
+		return nil, errSubscriptionNotFound
+	}
+	return copySubscription(sub), nil
+}
+
+func (r *memorySubscriptionRepo) Update(ctx context.Context, id string, req *model.UpdateSubscriptionRequest, check SubscriptionCheck) (*model.Subscription, error) {
+	if req.ServiceName == nil && req.Price == nil && req.StartDate == nil && req.EndDate == nil {
+		return nil, errNoFields
+	}
+	id, ok := canonicalUUID(id)
+	if !ok {
+		return nil, errMalformedValue
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+	current, err := r.store.checkSubscription(tenantID, id, check)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := copySubscription(current)
+	if req.ServiceName != nil {
+		sub.ServiceName = *req.ServiceName
+	}
+	if req.Price != nil {
+		sub.Price = *req.Price
+	}
+	if req.StartDate != nil {
+		sub.StartDate = *req.StartDate
+	}
+	if req.EndDate != nil {
+		endDate := *req.EndDate
+		sub.EndDate = &endDate
+	}
+	sub.UpdatedAt = time.Now().UTC()
+
+	if err := r.store.apply(&storeRecord{Op: opPutSubscription, TenantID: tenantID, Subscription: sub}); err != nil {
+		return nil, err
+	}
+	return copySubscription(sub), nil
+}
+
+func (r *memorySubscriptionRepo) Delete(ctx context.Context, id string, check SubscriptionCheck) (*model.Subscription, error) {
+	id, ok := canonicalUUID(id)
+	if !ok {
+		return nil, errMalformedValue
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+	current, err := r.store.checkSubscription(tenantID, id, check)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.store.apply(&storeRecord{Op: opDeleteSubscription, TenantID: tenantID, ID: id}); err != nil {
+		return nil, err
+	}
+	return copySubscription(current), nil
+}
+
+// checkSubscription runs check on subscription id, like lockSubscription. mu
+// must be held for writing, so that nothing changes it before the caller does.
+func (s *MemoryStore) checkSubscription(tenantID, id string, check SubscriptionCheck) (*model.Subscription, error) {
+	current, ok := s.subscriptions[tenantID][id]
+	if !ok {
+		return nil, errSubscriptionNotFound
+	}
+	if check != nil {
+		if err := check(copySubscription(current)); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+func (r *memorySubscriptionRepo) List(ctx context.Context, userID *string, serviceName *string) ([]*model.Subscription, error) {
+	if userID != nil {
+		id, ok := canonicalUUID(*userID)
+		if !ok {
+			return nil, errMalformedValue
+		}
+		userID = &id
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var subscriptions []*model.Subscription
+	for _, sub := range r.store.subscriptions[tenant.FromContext(ctx)] {
+		if userID != nil && sub.UserID != *userID {
+			continue
+		}
+		if serviceName != nil && sub.ServiceName != *serviceName {
+			continue
+		}
+		subscriptions = append(subscriptions, copySubscription(sub))
+	}
+
+	// ORDER BY created_at DESC, ties broken by id to keep pages stable.
+	slices.SortFunc(subscriptions, func(a, b *model.Subscription) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return subscriptions, nil
+}
+
+func (r *memorySubscriptionRepo) GetSummary(ctx context.Context, req *model.SummaryRequest) (*model.SubscriptionSummary, error) {
+	userID := req.UserID
+	if userID != nil {
+		id, ok := canonicalUUID(*userID)
+		if !ok {
+			return nil, errMalformedValue
+		}
+		userID = &id
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var summary model.SubscriptionSummary
+	for _, sub := range r.store.subscriptions[tenant.FromContext(ctx)] {
+		if !activeBetween(sub, req.StartPeriod, req.EndPeriod) {
+			continue
+		}
+		if userID != nil && sub.UserID != *userID {
+			continue
+		}
+		if req.ServiceName != nil && sub.ServiceName != *req.ServiceName {
+			continue
+		}
+		summary.TotalCost += sub.Price
+		summary.Count++
+	}
+	return &summary, nil
+}
+
+func (r *memorySubscriptionRepo) ActiveStats(ctx context.Context) ([]*model.SubscriptionStats, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	month := time.Now().Format(model.MonthLayout)
+
+	var stats []*model.SubscriptionStats
+	for tenantID, subscriptions := range r.store.subscriptions {
+		tenantStats := &model.SubscriptionStats{TenantID: tenantID}
+		for _, sub := range subscriptions {
+			if activeBetween(sub, month, month) {
+				tenantStats.Active++
+				tenantStats.MonthlyCost += int64(sub.Price)
+			}
+		}
+		if tenantStats.Active > 0 {
+			stats = append(stats, tenantStats)
+		}
+	}
+	return stats, nil
+}
+
+// activeBetween matches the period filter of the SQL queries, dates are
+// normalized and compare as strings.
+func activeBetween(sub *model.Subscription, start, end string) bool {
+	return sub.StartDate <= end && (sub.EndDate == nil || *sub.EndDate >= start)
+}
+
+func copySubscription(sub *model.Subscription) *model.Subscription {
+	c := *sub
+	if sub.EndDate != nil {
+		endDate := *sub.EndDate
+		c.EndDate = &endDate
+	}
+	return &c
+}
+
+type memoryUserRepo struct {
+	store *MemoryStore
+}
+
+func NewMemoryUserRepository(store *MemoryStore) UserRepository {
+	return &memoryUserRepo{store: store}
+}
+
+func (r *memoryUserRepo) Create(ctx context.Context, user *model.User) error {
+	id := uuid.NewString()
+	if user.ID != "" {
+		var ok bool
+		if id, ok = canonicalUUID(user.ID); !ok {
+			return errMalformedValue
+		}
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+	users := r.store.tenantUsers(tenantID)
+
+	if _, ok := users[id]; ok || emailTaken(users, user.Email, "") {
+		return apperror.Conflict("user_exists", "user with this id or email already exists")
+	}
+
+	now := time.Now().UTC()
+	user.ID = id
+	user.TenantID = tenantID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	return r.store.apply(&storeRecord{Op: opPutUser, TenantID: tenantID, User: copyUser(user)})
+}
+
+func (r *memoryUserRepo) GetByID(ctx context.Context, id string) (*model.User, error) {
+	id, ok := canonicalUUID(id)
+	if !ok {
+		return nil, errMalformedValue
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[tenant.FromContext(ctx)][id]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (r *memoryUserRepo) Exists(ctx context.Context, id string) (bool, error) {
+	id, ok := canonicalUUID(id)
+	if !ok {
+		return false, errMalformedValue
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	_, exists := r.store.users[tenant.FromContext(ctx)][id]
+	return exists, nil
+}
+
+func (r *memoryUserRepo) Update(ctx context.Context, id string, req *model.UpdateUserRequest) error {
+	if req.Name == nil && req.Email == nil {
+		return errNoFields
+	}
+	id, ok := canonicalUUID(id)
+	if !ok {
+		return errMalformedValue
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+	users := r.store.users[tenantID]
+	current, ok := users[id]
+	if !ok {
+		return errUserNotFound
+	}
+	if emailTaken(users, req.Email, id) {
+		return apperror.Conflict("user_exists", "user with this email already exists")
+	}
+
+	user := copyUser(current)
+	if req.Name != nil {
+		name := *req.Name
+		user.Name = &name
+	}
+	if req.Email != nil {
+		email := *req.Email
+		user.Email = &email
+	}
+	user.UpdatedAt = time.Now().UTC()
+
+	return r.store.apply(&storeRecord{Op: opPutUser, TenantID: tenantID, User: user})
+}
+
+func (r *memoryUserRepo) Delete(ctx context.Context, id string) error {
+	id, ok := canonicalUUID(id)
+	if !ok {
+		return errMalformedValue
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+	if _, ok := r.store.users[tenantID][id]; !ok {
+		return errUserNotFound
+	}
+	for _, sub := range r.store.subscriptions[tenantID] {
+		if sub.UserID == id {
+			return apperror.Conflict("user_has_subscriptions", "user still has subscriptions")
+		}
+	}
+
+	return r.store.apply(&storeRecord{Op: opDeleteUser, TenantID: tenantID, ID: id})
+}
+
+func (r *memoryUserRepo) List(ctx context.Context) ([]*model.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var users []*model.User
+	for _, user := range r.store.users[tenant.FromContext(ctx)] {
+		users = append(users, copyUser(user))
+	}
+
+	slices.SortFunc(users, func(a, b *model.User) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return users, nil
+}
+
+func (r *memoryUserRepo) Purge(ctx context.Context, id string) (int, error) {
+	id, ok := canonicalUUID(id)
+	if !ok {
+		return 0, errMalformedValue
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+	if _, ok := r.store.users[tenantID][id]; !ok {
+		return 0, errUserNotFound
+	}
+
+	var recs []*storeRecord
+	for subID, sub := range r.store.subscriptions[tenantID] {
+		if sub.UserID == id {
+			recs = append(recs, &storeRecord{Op: opDeleteSubscription, TenantID: tenantID, ID: subID})
+		}
+	}
+	purged := len(recs)
+	recs = append(recs, &storeRecord{Op: opDeleteUser, TenantID: tenantID, ID: id})
+
+	if err := r.store.applyAll(recs); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// emailTaken reports whether another user than exceptID has the email, like
+// the unique index on (tenant_id, email).
+func emailTaken(users map[string]*model.User, email *string, exceptID string) bool {
+	if email == nil {
+		return false
+	}
+	for id, user := range users {
+		if id != exceptID && user.Email != nil && *user.Email == *email {
+			return true
+		}
+	}
+	return false
+}
+
+func copyUser(user *model.User) *model.User {
+	c := *user
+	if user.Name != nil {
+		name := *user.Name
+		c.Name = &name
+	}
+	if user.Email != nil {
+		email := *user.Email
+		c.Email = &email
+	}
+	if user.LegacyID != nil {
+		legacyID := *user.LegacyID
+		c.LegacyID = &legacyID
+	}
+	return &c
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"subscription-service/internal/model"
+)
+
+func TestCanonicalUUID(t *testing.T) {
+	const want = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+
+	tests := []struct {
+		name string
+		id   string
+		ok   bool
+	}{
+		{"canonical", want, true},
+		{"upper case", "60601FEE-2BF1-4721-AE6F-7636E79A0CBA", true},
+		{"without dashes", "60601fee2bf14721ae6f7636e79a0cba", true},
+		{"too short", "60601fee-2bf1-4721-ae6f", false},
+		{"not hex", "60601fee-2bf1-4721-ae6f-7636e79a0cbz", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := canonicalUUID(tt.id)
+			if ok != tt.ok || (ok && got != want) {
+				t.Errorf("canonicalUUID(%q) = %q, %v", tt.id, got, ok)
+			}
+		})
+	}
+}
+
+func TestMemoryUserRepositoryStoresCanonicalIDs(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository(NewMemoryStore())
+
+	user := &model.User{ID: "60601FEE2BF14721AE6F7636E79A0CBA"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if user.ID != "60601fee-2bf1-4721-ae6f-7636e79a0cba" {
+		t.Errorf("stored id = %q", user.ID)
+	}
+
+	for _, id := range []string{user.ID, "60601FEE-2BF1-4721-AE6F-7636E79A0CBA"} {
+		if exists, err := users.Exists(ctx, id); err != nil || !exists {
+			t.Errorf("Exists(%q) = %v, %v", id, exists, err)
+		}
+	}
+	if _, err := users.GetByID(ctx, "alice"); !errors.Is(err, errMalformedValue) {
+		t.Errorf("GetByID(malformed) err = %v, want errMalformedValue", err)
+	}
+}
+
+// flakyJournal accepts allowed appends and fails every later one.
+type flakyJournal struct {
+	allowed int
+}
+
+func (j *flakyJournal) append(*storeRecord) error {
+	if j.allowed == 0 {
+		return errors.New("disk full")
+	}
+	j.allowed--
+	return nil
+}
+
+func TestMemoryStoreBatchesAreAllOrNothing(t *testing.T) {
+	const userID = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+
+	for _, allowed := range []int{0, 1} {
+		t.Run(fmt.Sprintf("%d appends succeed", allowed), func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryStore()
+			users := NewMemoryUserRepository(store)
+			subscriptions := NewMemorySubscriptionRepository(store)
+			if err := users.Create(ctx, &model.User{ID: userID}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			for range 3 {
+				if err := subscriptions.CreateMany(ctx, []*model.Subscription{{ServiceName: "Netflix", UserID: userID, StartDate: "2025-01"}}); err != nil {
+					t.Fatalf("CreateMany: %v", err)
+				}
+			}
+
+			store.journal = &flakyJournal{allowed: allowed}
+			batch := []*model.Subscription{
+				{ServiceName: "Spotify", UserID: userID, StartDate: "2025-01"},
+				{ServiceName: "Spotify", UserID: userID, StartDate: "2025-02"},
+			}
+			err := subscriptions.CreateMany(ctx, batch)
+			list, _ := subscriptions.List(ctx, nil, ptr("Spotify"))
+			if (err == nil && len(list) != 2) || (err != nil && len(list) != 0) {
+				t.Errorf("CreateMany err = %v with %d of 2 subscriptions stored", err, len(list))
+			}
+
+			store.journal = &flakyJournal{allowed: allowed}
+			purged, err := users.Purge(ctx, userID)
+			exists, _ := users.Exists(ctx, userID)
+			left, _ := subscriptions.List(ctx, nil, nil)
+			if err == nil && (exists || len(left) != 0 || purged != 3+len(list)) {
+				t.Errorf("Purge purged %d but left the user %v and %d subscriptions", purged, exists, len(left))
+			}
+			if err != nil && (!exists || len(left) != 3+len(list)) {
+				t.Errorf("failed Purge left the user %v and %d subscriptions", exists, len(left))
+			}
+		})
+	}
+}
+
+func TestFileStoreReplaysBatches(t *testing.T) {
+	const userID = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "subscriptions.jsonl")
+
+	reopen := func(store *FileStore) *FileStore {
+		t.Helper()
+		if store != nil {
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+		}
+		store, err := OpenFileStore(path, 0)
+		if err != nil {
+			t.Fatalf("OpenFileStore: %v", err)
+		}
+		return store
+	}
+
+	store := reopen(nil)
+	if err := NewMemoryUserRepository(store.MemoryStore).Create(ctx, &model.User{ID: userID}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	err := NewMemorySubscriptionRepository(store.MemoryStore).CreateMany(ctx, []*model.Subscription{
+		{ServiceName: "Netflix", UserID: userID, StartDate: "2025-01"},
+		{ServiceName: "Spotify", UserID: userID, StartDate: "2025-02"},
+	})
+	if err != nil {
+		t.Fatalf("CreateMany: %v", err)
+	}
+
+	store = reopen(store)
+	list, err := NewMemorySubscriptionRepository(store.MemoryStore).List(ctx, nil, nil)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("after reopening: %d subscriptions, %v, want 2", len(list), err)
+	}
+	if _, err := NewMemoryUserRepository(store.MemoryStore).Purge(ctx, userID); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+
+	store = reopen(store)
+	defer store.Close()
+	list, _ = NewMemorySubscriptionRepository(store.MemoryStore).List(ctx, nil, nil)
+	if exists, _ := NewMemoryUserRepository(store.MemoryStore).Exists(ctx, userID); exists || len(list) != 0 {
+		t.Errorf("after reopening: user exists %v with %d subscriptions, want purged", exists, len(list))
+	}
+}
+
+func TestFileStoreIsExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subscriptions.jsonl")
+
+	store, err := OpenFileStore(path, 0)
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	if _, err := OpenFileStore(path, 0); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("second OpenFileStore err = %v, want in use", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	store, err = OpenFileStore(path, 0)
+	if err != nil {
+		t.Fatalf("OpenFileStore after Close: %v", err)
+	}
+	store.Close()
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"subscription-service/internal/event"
+	"subscription-service/internal/metrics"
+	"subscription-service/internal/model"
+	"subscription-service/internal/tenant"
+)
+
+type OutboxRepository interface {
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*model.OutboxMessage, error)
+	MarkPublished(ctx context.Context, id string) error
+	MarkFailed(ctx context.Context, id string, attempts int, lastError string, nextAttemptAt time.Time) error
+}
+
+type outboxRepo struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) OutboxRepository {
+	return &outboxRepo{db: db}
+}
+
+// ClaimPending leases unpublished messages of all tenants in creation order,
+// see webhookRepo.ClaimDueDeliveries for the locking scheme.
+func (r *outboxRepo) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*model.OutboxMessage, error) {
+	defer metrics.ObserveQuery("outbox", "ClaimPending", time.Now())
+
+	query := `
+		UPDATE outbox
+		SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE published_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	var messages []*model.OutboxMessage
+	err := acrossTenants(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &messages, query, limit, lease.Seconds())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// UPDATE ... RETURNING does not keep the subquery order.
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	return messages, nil
+}
+
+func (r *outboxRepo) MarkPublished(ctx context.Context, id string) error {
+	defer metrics.ObserveQuery("outbox", "MarkPublished", time.Now())
+
+	query := `UPDATE outbox SET published_at = CURRENT_TIMESTAMP, last_error = NULL WHERE id = $1`
+
+	return acrossTenants(ctx, r.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query, id)
+		return err
+	})
+}
+
+func (r *outboxRepo) MarkFailed(ctx context.Context, id string, attempts int, lastError string, nextAttemptAt time.Time) error {
+	defer metrics.ObserveQuery("outbox", "MarkFailed", time.Now())
+
+	query := `UPDATE outbox SET attempts = $1, last_error = $2, next_attempt_at = $3 WHERE id = $4`
+
+	return acrossTenants(ctx, r.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query, attempts, lastError, nextAttemptAt, id)
+		return err
+	})
+}
+
+// enqueueEvent writes a domain event into the outbox using the caller's
+// transaction, so the event exists if and only if the change is committed.
+func enqueueEvent(ctx context.Context, tx *sqlx.Tx, aggregateType, aggregateID, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %w", eventType, err)
+	}
+
+	query := `
+		INSERT INTO outbox (tenant_id, aggregate_type, aggregate_id, event_type, schema_version, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		tenant.FromContext(ctx), aggregateType, aggregateID, eventType, event.SchemaVersion, payload)
+	if err != nil {
+		return fmt.Errorf("error writing %s event to outbox: %w", eventType, err)
+	}
+
+	return nil
+}
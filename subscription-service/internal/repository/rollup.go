@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"subscription-service/internal/metrics"
+	"subscription-service/internal/tracing"
+)
+
+type RollupRepository interface {
+	RebuildMonthlySpend(ctx context.Context) (int64, error)
+}
+
+type rollupRepo struct {
+	db *sqlx.DB
+}
+
+func NewRollupRepository(db *sqlx.DB) RollupRepository {
+	return &rollupRepo{db: db}
+}
+
+// RebuildMonthlySpend recomputes the monthly_spend rollup of every tenant from
+// the subscriptions and marks it fresh, it returns the number of rollup rows.
+// Subscription writes wait for the rebuild, so none is missed.
+func (r *rollupRepo) RebuildMonthlySpend(ctx context.Context) (rows int64, err error) {
+	defer metrics.ObserveQuery("rollup", "RebuildMonthlySpend", time.Now())
+	ctx, span := startSpan(ctx, "rollupRepo.RebuildMonthlySpend", "INSERT", "monthly_spend")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		INSERT INTO monthly_spend (tenant_id, user_id, service_name, month, started, started_spend, ended, ended_spend)
+		SELECT tenant_id, user_id, service_name, month, SUM(started), SUM(started_spend), SUM(ended), SUM(ended_spend)
+		FROM (
+			SELECT tenant_id, user_id, service_name, start_date AS month,
+			       1 AS started, price AS started_spend, 0 AS ended, 0 AS ended_spend
+			FROM subscriptions
+			UNION ALL
+			SELECT tenant_id, user_id, service_name, end_date,
+			       0, 0, 1, price
+			FROM subscriptions
+			WHERE end_date IS NOT NULL
+		) changes
+		GROUP BY tenant_id, user_id, service_name, month
+	`
+
+	err = acrossTenants(ctx, r.db, func(tx *sqlx.Tx) error {
+		// A rebuild may take longer than the statement timeout of the pool.
+		if _, err := tx.ExecContext(ctx, `SET LOCAL statement_timeout = 0`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE subscriptions IN SHARE MODE`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM monthly_spend`); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		if rows, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE rollups SET fresh = TRUE, rebuilt_at = CURRENT_TIMESTAMP WHERE name = 'monthly_spend'`)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return rows, nil
+}
+
+// monthlySpendFresh reports whether the monthly_spend rollup is complete and
+// can be read instead of the subscriptions.
+func monthlySpendFresh(ctx context.Context, tx *sqlx.Tx) (bool, error) {
+	var fresh bool
+	err := tx.GetContext(ctx, &fresh, `SELECT fresh FROM rollups WHERE name = 'monthly_spend'`)
+	return fresh, err
+}
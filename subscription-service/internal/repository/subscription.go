@@ -2,56 +2,135 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/metrics"
 	"subscription-service/internal/model"
+	"subscription-service/internal/tenant"
+	"subscription-service/internal/tracing"
+	"subscription-service/pkg/database"
 )
 
 type SubscriptionRepository interface {
 	Create(ctx context.Context, sub *model.Subscription) error
+	// CreateMany creates all subscriptions or, if one of them fails, none.
+	CreateMany(ctx context.Context, subs []*model.Subscription) error
 	GetByID(ctx context.Context, id string) (*model.Subscription, error)
-	Update(ctx context.Context, id string, req *model.UpdateSubscriptionRequest) error
-	Delete(ctx context.Context, id string) error
+	// Update and Delete lock the subscription, pass it to check, if not nil,
+	// and change it in the same transaction unless check fails. They return
+	// the subscription as updated or deleted.
+	Update(ctx context.Context, id string, req *model.UpdateSubscriptionRequest, check SubscriptionCheck) (*model.Subscription, error)
+	Delete(ctx context.Context, id string, check SubscriptionCheck) (*model.Subscription, error)
 	List(ctx context.Context, userID *string, serviceName *string) ([]*model.Subscription, error)
 	GetSummary(ctx context.Context, req *model.SummaryRequest) (*model.SubscriptionSummary, error)
+	ActiveStats(ctx context.Context) ([]*model.SubscriptionStats, error)
 }
 
+// SubscriptionCheck vets the current state of a subscription before it is
+// changed, an error aborts the change.
+type SubscriptionCheck func(current *model.Subscription) error
+
+var (
+	errSubscriptionNotFound = apperror.NotFound("subscription_not_found", "subscription not found")
+	errNoFields             = apperror.Validation("no_fields", "no fields to update")
+)
+
 type subscriptionRepo struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	replica *database.Router
 }
 
 func NewSubscriptionRepository(db *sqlx.DB) SubscriptionRepository {
 	return &subscriptionRepo{db: db}
 }
 
-func (r *subscriptionRepo) Create(ctx context.Context, sub *model.Subscription) error {
+// NewReplicatedSubscriptionRepository reads subscriptions and summaries from
+// the replicas of router.
+func NewReplicatedSubscriptionRepository(router *database.Router) SubscriptionRepository {
+	return &subscriptionRepo{db: router.Primary(), replica: router}
+}
+
+func (r *subscriptionRepo) reader(ctx context.Context) *sqlx.DB {
+	if r.replica == nil {
+		return r.db
+	}
+	return r.replica.Reader(ctx)
+}
+
+func (r *subscriptionRepo) Create(ctx context.Context, sub *model.Subscription) (err error) {
+	defer metrics.ObserveQuery("subscription", "Create", time.Now())
+	ctx, span := startSpan(ctx, "subscriptionRepo.Create", "INSERT", "subscriptions")
+	defer func() { tracing.End(span, err) }()
+
+	slog.DebugContext(ctx, "inserting subscription", "user_id", sub.UserID, "service_name", sub.ServiceName)
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return insertSubscription(ctx, tx, sub)
+	})
+}
+
+func (r *subscriptionRepo) CreateMany(ctx context.Context, subs []*model.Subscription) (err error) {
+	defer metrics.ObserveQuery("subscription", "CreateMany", time.Now())
+	ctx, span := startSpan(ctx, "subscriptionRepo.CreateMany", "INSERT", "subscriptions")
+	defer func() { tracing.End(span, err) }()
+
+	slog.DebugContext(ctx, "inserting subscriptions", "count", len(subs))
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		for _, sub := range subs {
+			if err := insertSubscription(ctx, tx, sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertSubscription(ctx context.Context, tx *sqlx.Tx, sub *model.Subscription) error {
 	query := `
-		INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, updated_at
+		INSERT INTO subscriptions (tenant_id, service_name, price, user_id, start_date, end_date)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, tenant_id, created_at, updated_at
 	`
 
-	log.Printf("Creating subscription for user %s, service: %s", sub.UserID, sub.ServiceName)
-
-	return r.db.QueryRowContext(ctx, query,
+	err := tx.QueryRowContext(ctx, query,
+		tenant.FromContext(ctx),
 		sub.ServiceName,
 		sub.Price,
 		sub.UserID,
 		sub.StartDate,
 		sub.EndDate,
-	).Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt)
+	).Scan(&sub.ID, &sub.TenantID, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return enqueueEvent(ctx, tx, model.AggregateSubscription, sub.ID, model.EventSubscriptionCreated, sub)
 }
 
-func (r *subscriptionRepo) GetByID(ctx context.Context, id string) (*model.Subscription, error) {
-	query := `SELECT * FROM subscriptions WHERE id = $1`
+func (r *subscriptionRepo) GetByID(ctx context.Context, id string) (_ *model.Subscription, err error) {
+	defer metrics.ObserveQuery("subscription", "GetByID", time.Now())
+	ctx, span := startSpan(ctx, "subscriptionRepo.GetByID", "SELECT", "subscriptions")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT * FROM subscriptions WHERE id = $1 AND tenant_id = $2`
 
 	var sub model.Subscription
-	log.Printf("Fetching subscription with ID: %s", id)
+	slog.DebugContext(ctx, "fetching subscription", "subscription_id", id)
 
-	err := r.db.GetContext(ctx, &sub, query, id)
+	err = withTenant(ctx, r.reader(ctx), func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &sub, query, id, tenant.FromContext(ctx))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errSubscriptionNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +138,11 @@ func (r *subscriptionRepo) GetByID(ctx context.Context, id string) (*model.Subsc
 	return &sub, nil
 }
 
-func (r *subscriptionRepo) Update(ctx context.Context, id string, req *model.UpdateSubscriptionRequest) error {
+func (r *subscriptionRepo) Update(ctx context.Context, id string, req *model.UpdateSubscriptionRequest, check SubscriptionCheck) (_ *model.Subscription, err error) {
+	defer metrics.ObserveQuery("subscription", "Update", time.Now())
+	ctx, span := startSpan(ctx, "subscriptionRepo.Update", "UPDATE", "subscriptions")
+	defer func() { tracing.End(span, err) }()
+
 	var setClauses []string
 	var args []interface{}
 	argPos := 1
@@ -89,52 +172,91 @@ func (r *subscriptionRepo) Update(ctx context.Context, id string, req *model.Upd
 	}
 
 	if len(setClauses) == 0 {
-		return fmt.Errorf("no fields to update")
+		return nil, errNoFields
 	}
 
 	setClauses = append(setClauses, "updated_at = CURRENT_TIMESTAMP")
-	args = append(args, id)
+	args = append(args, id, tenant.FromContext(ctx))
 
-	query := fmt.Sprintf("UPDATE subscriptions SET %s WHERE id = $%d",
-		strings.Join(setClauses, ", "), argPos)
+	query := fmt.Sprintf("UPDATE subscriptions SET %s WHERE id = $%d AND tenant_id = $%d RETURNING *",
+		strings.Join(setClauses, ", "), argPos, argPos+1)
 
-	log.Printf("Updating subscription with ID: %s", id)
+	slog.DebugContext(ctx, "updating subscription", "subscription_id", id, "fields", len(setClauses)-1)
 
-	result, err := r.db.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
+	var sub model.Subscription
+	err = withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		if err := lockSubscription(ctx, tx, id, check); err != nil {
+			return err
+		}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("subscription not found")
+		if err := tx.GetContext(ctx, &sub, query, args...); err != nil {
+			return err
+		}
+
+		return enqueueEvent(ctx, tx, model.AggregateSubscription, sub.ID, model.EventSubscriptionUpdated, &sub)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &sub, nil
 }
 
-func (r *subscriptionRepo) Delete(ctx context.Context, id string) error {
-	query := `DELETE FROM subscriptions WHERE id = $1`
+func (r *subscriptionRepo) Delete(ctx context.Context, id string, check SubscriptionCheck) (_ *model.Subscription, err error) {
+	defer metrics.ObserveQuery("subscription", "Delete", time.Now())
+	ctx, span := startSpan(ctx, "subscriptionRepo.Delete", "DELETE", "subscriptions")
+	defer func() { tracing.End(span, err) }()
+
+	query := `DELETE FROM subscriptions WHERE id = $1 AND tenant_id = $2 RETURNING *`
+
+	slog.DebugContext(ctx, "deleting subscription", "subscription_id", id)
 
-	log.Printf("Deleting subscription with ID: %s", id)
+	var sub model.Subscription
+	err = withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		if err := lockSubscription(ctx, tx, id, check); err != nil {
+			return err
+		}
+
+		if err := tx.GetContext(ctx, &sub, query, id, tenant.FromContext(ctx)); err != nil {
+			return err
+		}
 
-	result, err := r.db.ExecContext(ctx, query, id)
+		return enqueueEvent(ctx, tx, model.AggregateSubscription, sub.ID, model.EventSubscriptionDeleted, &sub)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("subscription not found")
+	return &sub, nil
+}
+
+// lockSubscription locks subscription id until tx ends and runs check on it,
+// so that what check saw is still true when the change commits.
+func lockSubscription(ctx context.Context, tx *sqlx.Tx, id string, check SubscriptionCheck) error {
+	var current model.Subscription
+	err := tx.GetContext(ctx, &current, `SELECT * FROM subscriptions WHERE id = $1 AND tenant_id = $2 FOR UPDATE`,
+		id, tenant.FromContext(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
+		return errSubscriptionNotFound
+	}
+	if err != nil {
+		return err
 	}
 
-	return nil
+	if check == nil {
+		return nil
+	}
+	return check(&current)
 }
 
-func (r *subscriptionRepo) List(ctx context.Context, userID *string, serviceName *string) ([]*model.Subscription, error) {
-	query := `SELECT * FROM subscriptions WHERE 1=1`
-	var args []interface{}
-	argPos := 1
+func (r *subscriptionRepo) List(ctx context.Context, userID *string, serviceName *string) (_ []*model.Subscription, err error) {
+	defer metrics.ObserveQuery("subscription", "List", time.Now())
+	ctx, span := startSpan(ctx, "subscriptionRepo.List", "SELECT", "subscriptions")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT * FROM subscriptions WHERE tenant_id = $1`
+	args := []interface{}{tenant.FromContext(ctx)}
+	argPos := 2
 
 	if userID != nil {
 		query += fmt.Sprintf(" AND user_id = $%d", argPos)
@@ -150,10 +272,12 @@ func (r *subscriptionRepo) List(ctx context.Context, userID *string, serviceName
 
 	query += " ORDER BY created_at DESC"
 
-	log.Printf("Listing subscriptions, userID: %v, serviceName: %v", userID, serviceName)
+	slog.DebugContext(ctx, "listing subscriptions", "user_id", deref(userID), "service_name", deref(serviceName))
 
 	var subscriptions []*model.Subscription
-	err := r.db.SelectContext(ctx, &subscriptions, query, args...)
+	err = withTenant(ctx, r.reader(ctx), func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &subscriptions, query, args...)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -161,38 +285,117 @@ func (r *subscriptionRepo) List(ctx context.Context, userID *string, serviceName
 	return subscriptions, nil
 }
 
-func (r *subscriptionRepo) GetSummary(ctx context.Context, req *model.SummaryRequest) (*model.SubscriptionSummary, error) {
+// GetSummary reads the monthly_spend rollup when it is fresh and scans the
+// subscriptions otherwise, both give the same result.
+func (r *subscriptionRepo) GetSummary(ctx context.Context, req *model.SummaryRequest) (_ *model.SubscriptionSummary, err error) {
+	defer metrics.ObserveQuery("subscription", "GetSummary", time.Now())
+	ctx, span := startSpan(ctx, "subscriptionRepo.GetSummary", "SELECT", "subscriptions")
+	defer func() { tracing.End(span, err) }()
+
 	query := `
 		SELECT COALESCE(SUM(price), 0) as total_cost, COUNT(*) as count
 		FROM subscriptions 
-		WHERE start_date <= $1 
-		AND (end_date IS NULL OR end_date >= $2)
+		WHERE tenant_id = $1
+		AND start_date <= $2 
+		AND (end_date IS NULL OR end_date >= $3)
+	`
+	rollupQuery := `
+		SELECT COALESCE(SUM(started_spend) FILTER (WHERE month <= $2), 0)
+		     - COALESCE(SUM(ended_spend) FILTER (WHERE month < $3), 0) AS total_cost,
+		       COALESCE(SUM(started) FILTER (WHERE month <= $2), 0)
+		     - COALESCE(SUM(ended) FILTER (WHERE month < $3), 0) AS count
+		FROM monthly_spend
+		WHERE tenant_id = $1
+		AND month <= $2
 	`
 
+	var filters string
 	var args []interface{}
-	args = append(args, req.EndPeriod, req.StartPeriod)
-	argPos := 3
+	args = append(args, tenant.FromContext(ctx), req.EndPeriod, req.StartPeriod)
+	argPos := 4
 
 	if req.UserID != nil {
-		query += fmt.Sprintf(" AND user_id = $%d", argPos)
+		filters += fmt.Sprintf(" AND user_id = $%d", argPos)
 		args = append(args, *req.UserID)
 		argPos++
 	}
 
 	if req.ServiceName != nil {
-		query += fmt.Sprintf(" AND service_name = $%d", argPos)
+		filters += fmt.Sprintf(" AND service_name = $%d", argPos)
 		args = append(args, *req.ServiceName)
 		argPos++
 	}
 
-	log.Printf("Calculating summary for period %s to %s, userID: %v, serviceName: %v",
-		req.StartPeriod, req.EndPeriod, req.UserID, req.ServiceName)
+	slog.DebugContext(ctx, "calculating summary",
+		"start_period", req.StartPeriod, "end_period", req.EndPeriod,
+		"user_id", deref(req.UserID), "service_name", deref(req.ServiceName))
 
 	var summary model.SubscriptionSummary
-	err := r.db.GetContext(ctx, &summary, query, args...)
+	err = withTenant(ctx, r.reader(ctx), func(tx *sqlx.Tx) error {
+		fresh, err := monthlySpendFresh(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if fresh {
+			return tx.GetContext(ctx, &summary, rollupQuery+filters, args...)
+		}
+		return tx.GetContext(ctx, &summary, query+filters, args...)
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &summary, nil
 }
+
+// ActiveStats aggregates the subscriptions active in the current month for
+// every tenant, from the monthly_spend rollup when it is fresh.
+func (r *subscriptionRepo) ActiveStats(ctx context.Context) (_ []*model.SubscriptionStats, err error) {
+	defer metrics.ObserveQuery("subscription", "ActiveStats", time.Now())
+	ctx, span := startSpan(ctx, "subscriptionRepo.ActiveStats", "SELECT", "subscriptions")
+	defer func() { tracing.End(span, err) }()
+
+	query := `
+		SELECT tenant_id, COUNT(*) AS active, COALESCE(SUM(price), 0) AS monthly_cost
+		FROM subscriptions
+		WHERE start_date <= to_char(CURRENT_DATE, 'YYYY-MM')
+		AND (end_date IS NULL OR end_date >= to_char(CURRENT_DATE, 'YYYY-MM'))
+		GROUP BY tenant_id
+	`
+	rollupQuery := `
+		SELECT tenant_id, active, monthly_cost
+		FROM (
+			SELECT tenant_id,
+			       SUM(started) - COALESCE(SUM(ended) FILTER (WHERE month < to_char(CURRENT_DATE, 'YYYY-MM')), 0) AS active,
+			       SUM(started_spend) - COALESCE(SUM(ended_spend) FILTER (WHERE month < to_char(CURRENT_DATE, 'YYYY-MM')), 0) AS monthly_cost
+			FROM monthly_spend
+			WHERE month <= to_char(CURRENT_DATE, 'YYYY-MM')
+			GROUP BY tenant_id
+		) stats
+		WHERE active > 0
+	`
+
+	var stats []*model.SubscriptionStats
+	err = acrossTenants(ctx, r.reader(ctx), func(tx *sqlx.Tx) error {
+		fresh, err := monthlySpendFresh(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if fresh {
+			return tx.SelectContext(ctx, &stats, rollupQuery)
+		}
+		return tx.SelectContext(ctx, &stats, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
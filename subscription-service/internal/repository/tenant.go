@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/metrics"
+	"subscription-service/internal/model"
+	"subscription-service/internal/tenant"
+)
+
+type TenantRepository interface {
+	Create(ctx context.Context, t *model.Tenant) error
+	List(ctx context.Context) ([]*model.Tenant, error)
+}
+
+type tenantRepo struct {
+	db *sqlx.DB
+}
+
+func NewTenantRepository(db *sqlx.DB) TenantRepository {
+	return &tenantRepo{db: db}
+}
+
+func (r *tenantRepo) Create(ctx context.Context, t *model.Tenant) error {
+	defer metrics.ObserveQuery("tenant", "Create", time.Now())
+
+	query := `INSERT INTO tenants (id, name) VALUES ($1, $2) RETURNING created_at`
+
+	slog.DebugContext(ctx, "inserting tenant", "tenant_id", t.ID)
+
+	err := r.db.QueryRowContext(ctx, query, t.ID, t.Name).Scan(&t.CreatedAt)
+	if pqCode(err) == pqUniqueViolation {
+		return apperror.Wrap(apperror.ErrConflict, "tenant_exists", "tenant already exists", err)
+	}
+	return dbError(err)
+}
+
+func (r *tenantRepo) List(ctx context.Context) ([]*model.Tenant, error) {
+	defer metrics.ObserveQuery("tenant", "List", time.Now())
+
+	query := `SELECT * FROM tenants ORDER BY id`
+
+	var tenants []*model.Tenant
+	err := r.db.SelectContext(ctx, &tenants, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return tenants, nil
+}
+
+// withTenant runs fn in a transaction bound to the tenant of ctx. Queries
+// still filter by tenant_id explicitly, the app.tenant_id setting is what
+// the row-level security policies check in addition.
+func withTenant(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	return withSetting(ctx, db, "app.tenant_id", tenant.FromContext(ctx), fn)
+}
+
+// acrossTenants runs fn in a transaction that bypasses the row-level security
+// policies, for aggregates that have to see every tenant.
+func acrossTenants(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	return withSetting(ctx, db, "app.bypass_rls", "on", fn)
+}
+
+func withSetting(ctx context.Context, db *sqlx.DB, name, value string, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT set_config($1, $2, true)`, name, value); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return dbError(err)
+	}
+
+	return dbError(tx.Commit())
+}
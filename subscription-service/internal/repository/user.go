@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/metrics"
+	"subscription-service/internal/model"
+	"subscription-service/internal/tenant"
+)
+
+type UserRepository interface {
+	Create(ctx context.Context, user *model.User) error
+	GetByID(ctx context.Context, id string) (*model.User, error)
+	Exists(ctx context.Context, id string) (bool, error)
+	Update(ctx context.Context, id string, req *model.UpdateUserRequest) error
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) ([]*model.User, error)
+	// Purge deletes the user together with their subscriptions and every
+	// pending or delivered event that carries their data, and returns the
+	// number of deleted subscriptions.
+	Purge(ctx context.Context, id string) (int, error)
+}
+
+var errUserNotFound = apperror.NotFound("user_not_found", "user not found")
+
+type userRepo struct {
+	db *sqlx.DB
+}
+
+func NewUserRepository(db *sqlx.DB) UserRepository {
+	return &userRepo{db: db}
+}
+
+func (r *userRepo) Create(ctx context.Context, user *model.User) error {
+	defer metrics.ObserveQuery("user", "Create", time.Now())
+
+	query := `
+		INSERT INTO users (id, tenant_id, name, email)
+		VALUES (COALESCE($1::uuid, gen_random_uuid()), $2, $3, $4)
+		RETURNING id, tenant_id, created_at, updated_at
+	`
+
+	var id *string
+	if user.ID != "" {
+		id = &user.ID
+	}
+
+	slog.DebugContext(ctx, "inserting user", "user_id", user.ID)
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowContext(ctx, query,
+			id,
+			tenant.FromContext(ctx),
+			user.Name,
+			user.Email,
+		).Scan(&user.ID, &user.TenantID, &user.CreatedAt, &user.UpdatedAt)
+		if pqCode(err) == pqUniqueViolation {
+			return apperror.Wrap(apperror.ErrConflict, "user_exists", "user with this id or email already exists", err)
+		}
+		return err
+	})
+}
+
+func (r *userRepo) GetByID(ctx context.Context, id string) (*model.User, error) {
+	defer metrics.ObserveQuery("user", "GetByID", time.Now())
+
+	query := `SELECT * FROM users WHERE id = $1 AND tenant_id = $2`
+
+	var user model.User
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &user, query, id, tenant.FromContext(ctx))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *userRepo) Exists(ctx context.Context, id string) (bool, error) {
+	defer metrics.ObserveQuery("user", "Exists", time.Now())
+
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND tenant_id = $2)`
+
+	var exists bool
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &exists, query, id, tenant.FromContext(ctx))
+	})
+	return exists, err
+}
+
+func (r *userRepo) Update(ctx context.Context, id string, req *model.UpdateUserRequest) error {
+	defer metrics.ObserveQuery("user", "Update", time.Now())
+
+	var setClauses []string
+	var args []interface{}
+	argPos := 1
+
+	if req.Name != nil {
+		setClauses = append(setClauses, fmt.Sprintf("name = $%d", argPos))
+		args = append(args, *req.Name)
+		argPos++
+	}
+
+	if req.Email != nil {
+		setClauses = append(setClauses, fmt.Sprintf("email = $%d", argPos))
+		args = append(args, *req.Email)
+		argPos++
+	}
+
+	if len(setClauses) == 0 {
+		return errNoFields
+	}
+
+	setClauses = append(setClauses, "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, id, tenant.FromContext(ctx))
+
+	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d AND tenant_id = $%d",
+		strings.Join(setClauses, ", "), argPos, argPos+1)
+
+	slog.DebugContext(ctx, "updating user", "user_id", id)
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if pqCode(err) == pqUniqueViolation {
+			return apperror.Wrap(apperror.ErrConflict, "user_exists", "user with this email already exists", err)
+		}
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			return errUserNotFound
+		}
+
+		return nil
+	})
+}
+
+func (r *userRepo) Delete(ctx context.Context, id string) error {
+	defer metrics.ObserveQuery("user", "Delete", time.Now())
+
+	query := `DELETE FROM users WHERE id = $1 AND tenant_id = $2`
+
+	slog.DebugContext(ctx, "deleting user", "user_id", id)
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id, tenant.FromContext(ctx))
+		if pqCode(err) == pqForeignKeyViolation {
+			return apperror.Wrap(apperror.ErrConflict, "user_has_subscriptions", "user still has subscriptions", err)
+		}
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			return errUserNotFound
+		}
+
+		return nil
+	})
+}
+
+func (r *userRepo) List(ctx context.Context) ([]*model.User, error) {
+	defer metrics.ObserveQuery("user", "List", time.Now())
+
+	query := `SELECT * FROM users WHERE tenant_id = $1 ORDER BY created_at DESC`
+
+	var users []*model.User
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &users, query, tenant.FromContext(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *userRepo) Purge(ctx context.Context, id string) (int, error) {
+	defer metrics.ObserveQuery("user", "Purge", time.Now())
+
+	slog.DebugContext(ctx, "purging user", "user_id", id)
+
+	var purged int64
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		tenantID := tenant.FromContext(ctx)
+
+		var exists bool
+		if err := tx.GetContext(ctx, &exists,
+			`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND tenant_id = $2)`, id, tenantID); err != nil {
+			return err
+		}
+		if !exists {
+			return errUserNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM outbox WHERE tenant_id = $1 AND payload->>'user_id' = $2`, tenantID, id); err != nil {
+			return fmt.Errorf("error deleting outbox messages: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM webhook_deliveries WHERE tenant_id = $1 AND payload->'data'->>'user_id' = $2`, tenantID, id); err != nil {
+			return fmt.Errorf("error deleting webhook deliveries: %w", err)
+		}
+
+		result, err := tx.ExecContext(ctx,
+			`DELETE FROM subscriptions WHERE user_id = $1 AND tenant_id = $2`, id, tenantID)
+		if err != nil {
+			return fmt.Errorf("error deleting subscriptions: %w", err)
+		}
+		purged, _ = result.RowsAffected()
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1 AND tenant_id = $2`, id, tenantID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(purged), nil
+}
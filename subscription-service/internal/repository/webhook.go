@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/metrics"
+	"subscription-service/internal/model"
+	"subscription-service/internal/tenant"
+)
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *model.Webhook) error
+	GetByID(ctx context.Context, id string) (*model.Webhook, error)
+	List(ctx context.Context) ([]*model.Webhook, error)
+	ListByEvent(ctx context.Context, eventType string) ([]*model.Webhook, error)
+	Delete(ctx context.Context, id string) error
+
+	// CreateDelivery returns false without creating anything when the event
+	// already has a delivery to the webhook, replays are always created.
+	CreateDelivery(ctx context.Context, delivery *model.WebhookDelivery) (bool, error)
+	GetDelivery(ctx context.Context, webhookID, id string) (*model.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, webhookID string) ([]*model.WebhookDelivery, error)
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+}
+
+var (
+	errWebhookNotFound  = apperror.NotFound("webhook_not_found", "webhook not found")
+	errDeliveryNotFound = apperror.NotFound("delivery_not_found", "delivery not found")
+)
+
+type webhookRepo struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(db *sqlx.DB) WebhookRepository {
+	return &webhookRepo{db: db}
+}
+
+func (r *webhookRepo) Create(ctx context.Context, webhook *model.Webhook) error {
+	defer metrics.ObserveQuery("webhook", "Create", time.Now())
+
+	query := `
+		INSERT INTO webhooks (tenant_id, url, secret, events, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, tenant_id, created_at, updated_at
+	`
+
+	slog.DebugContext(ctx, "inserting webhook", "url", webhook.URL, "events", webhook.Events)
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.QueryRowContext(ctx, query,
+			tenant.FromContext(ctx),
+			webhook.URL,
+			webhook.Secret,
+			webhook.Events,
+			webhook.Active,
+		).Scan(&webhook.ID, &webhook.TenantID, &webhook.CreatedAt, &webhook.UpdatedAt)
+	})
+}
+
+func (r *webhookRepo) GetByID(ctx context.Context, id string) (*model.Webhook, error) {
+	defer metrics.ObserveQuery("webhook", "GetByID", time.Now())
+
+	query := `SELECT * FROM webhooks WHERE id = $1 AND tenant_id = $2`
+
+	var webhook model.Webhook
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &webhook, query, id, tenant.FromContext(ctx))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errWebhookNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	return &webhook, nil
+}
+
+func (r *webhookRepo) List(ctx context.Context) ([]*model.Webhook, error) {
+	defer metrics.ObserveQuery("webhook", "List", time.Now())
+
+	query := `SELECT * FROM webhooks WHERE tenant_id = $1 ORDER BY created_at DESC`
+
+	var webhooks []*model.Webhook
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &webhooks, query, tenant.FromContext(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (r *webhookRepo) ListByEvent(ctx context.Context, eventType string) ([]*model.Webhook, error) {
+	defer metrics.ObserveQuery("webhook", "ListByEvent", time.Now())
+
+	query := `SELECT * FROM webhooks WHERE tenant_id = $1 AND active AND $2 = ANY(events)`
+
+	var webhooks []*model.Webhook
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &webhooks, query, tenant.FromContext(ctx), eventType)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (r *webhookRepo) Delete(ctx context.Context, id string) error {
+	defer metrics.ObserveQuery("webhook", "Delete", time.Now())
+
+	query := `DELETE FROM webhooks WHERE id = $1 AND tenant_id = $2`
+
+	slog.DebugContext(ctx, "deleting webhook", "webhook_id", id)
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			return errWebhookNotFound
+		}
+		return nil
+	})
+}
+
+func (r *webhookRepo) CreateDelivery(ctx context.Context, delivery *model.WebhookDelivery) (bool, error) {
+	defer metrics.ObserveQuery("webhook", "CreateDelivery", time.Now())
+
+	query := `
+		INSERT INTO webhook_deliveries (tenant_id, webhook_id, event_id, event_type, payload, status, replay_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (webhook_id, event_id) WHERE replay_of IS NULL DO NOTHING
+		RETURNING id, tenant_id, attempts, next_attempt_at, created_at, updated_at
+	`
+
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.QueryRowContext(ctx, query,
+			tenant.FromContext(ctx),
+			delivery.WebhookID,
+			delivery.EventID,
+			delivery.EventType,
+			[]byte(delivery.Payload),
+			delivery.Status,
+			delivery.ReplayOf,
+		).Scan(&delivery.ID, &delivery.TenantID, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *webhookRepo) GetDelivery(ctx context.Context, webhookID, id string) (*model.WebhookDelivery, error) {
+	defer metrics.ObserveQuery("webhook", "GetDelivery", time.Now())
+
+	query := `SELECT * FROM webhook_deliveries WHERE id = $1 AND webhook_id = $2 AND tenant_id = $3`
+
+	var delivery model.WebhookDelivery
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &delivery, query, id, webhookID, tenant.FromContext(ctx))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errDeliveryNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	return &delivery, nil
+}
+
+func (r *webhookRepo) ListDeliveries(ctx context.Context, webhookID string) ([]*model.WebhookDelivery, error) {
+	defer metrics.ObserveQuery("webhook", "ListDeliveries", time.Now())
+
+	query := `SELECT * FROM webhook_deliveries WHERE webhook_id = $1 AND tenant_id = $2 ORDER BY created_at DESC`
+
+	var deliveries []*model.WebhookDelivery
+	err := withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &deliveries, query, webhookID, tenant.FromContext(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDueDeliveries leases pending deliveries of all tenants by pushing their
+// next attempt into the future, so concurrent workers never pick up the same
+// row twice.
+func (r *webhookRepo) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	defer metrics.ObserveQuery("webhook", "ClaimDueDeliveries", time.Now())
+
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	var deliveries []*model.WebhookDelivery
+	err := acrossTenants(ctx, r.db, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &deliveries, query, limit, lease.Seconds())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepo) UpdateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	defer metrics.ObserveQuery("webhook", "UpdateDelivery", time.Now())
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, response_status = $3, last_error = $4,
+		    next_attempt_at = $5, delivered_at = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7
+	`
+
+	return withTenant(ctx, r.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query,
+			delivery.Status,
+			delivery.Attempts,
+			delivery.ResponseStatus,
+			delivery.LastError,
+			delivery.NextAttemptAt,
+			delivery.DeliveredAt,
+			delivery.ID,
+		)
+		return err
+	})
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"subscription-service/internal/config"
+	"subscription-service/internal/event"
+	"subscription-service/internal/health"
+	"subscription-service/internal/repository"
+)
+
+// OutboxRelay publishes events committed to the outbox table. A message is
+// marked published only after the publisher accepted it, so a crash between
+// the two steps results in a redelivery rather than a lost event.
+type OutboxRelay struct {
+	repo      repository.OutboxRepository
+	publisher event.EventPublisher
+	cfg       config.EventsConfig
+	heartbeat health.Heartbeat
+}
+
+func NewOutboxRelay(repo repository.OutboxRepository, publisher event.EventPublisher, cfg config.EventsConfig) *OutboxRelay {
+	return &OutboxRelay{repo: repo, publisher: publisher, cfg: cfg}
+}
+
+func (r *OutboxRelay) Run(ctx context.Context) {
+	slog.Info("outbox relay started", "poll_interval", r.cfg.PollInterval)
+	r.heartbeat.Beat()
+	defer r.heartbeat.Stop()
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("outbox relay stopped")
+			return
+		case <-ticker.C:
+			r.processBatch(ctx)
+			r.heartbeat.Beat()
+		}
+	}
+}
+
+// Health reports the relay as unhealthy when its loop has stalled.
+func (r *OutboxRelay) Health(staleAfter time.Duration) health.Check {
+	return r.heartbeat.Check(staleAfter)
+}
+
+func (r *OutboxRelay) processBatch(ctx context.Context) {
+	messages, err := r.repo.ClaimPending(ctx, r.cfg.BatchSize, r.cfg.Lease)
+	if err != nil {
+		slog.ErrorContext(ctx, "error claiming outbox messages", "error", err)
+		return
+	}
+
+	// A claimed message is finished even during shutdown, publishers have
+	// their own timeouts. Unclaimed work is left to the next start.
+	itemCtx := context.WithoutCancel(ctx)
+
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			return
+		}
+		envelope := event.NewEnvelope(r.cfg.Source, msg)
+
+		if err := r.publisher.Publish(itemCtx, envelope); err != nil {
+			attempts := msg.Attempts + 1
+			next := time.Now().Add(backoff(r.cfg.InitialBackoff, r.cfg.MaxBackoff, attempts))
+			slog.WarnContext(ctx, "error publishing event", "event_id", msg.ID, "event_type", msg.EventType, "attempt", attempts, "error", err)
+
+			if err := r.repo.MarkFailed(itemCtx, msg.ID, attempts, err.Error(), next); err != nil {
+				slog.ErrorContext(ctx, "error saving outbox message", "event_id", msg.ID, "error", err)
+			}
+			continue
+		}
+
+		if err := r.repo.MarkPublished(itemCtx, msg.ID); err != nil {
+			slog.ErrorContext(ctx, "error marking outbox message as published", "event_id", msg.ID, "error", err)
+		}
+	}
+}
+
+// backoff doubles the initial delay for every failed attempt up to max.
+func backoff(initial, max time.Duration, attempt int) time.Duration {
+	delay := initial
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
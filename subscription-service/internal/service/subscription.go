@@ -2,107 +2,297 @@ package service
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"strings"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/auth"
 	"subscription-service/internal/model"
 	"subscription-service/internal/repository"
+	"subscription-service/internal/tracing"
 )
 
+var tracer = otel.Tracer("subscription-service/internal/service")
+
+var (
+	// ErrForbidden is returned when the caller tries to act on behalf of another user.
+	ErrForbidden = apperror.Forbidden("forbidden", "not allowed to act on behalf of another user")
+
+	errSubscriptionNotFound = apperror.NotFound("subscription_not_found", "subscription not found")
+	errUnknownUser          = apperror.Validation("unknown_user", "user does not exist")
+	errETagMismatch         = apperror.PreconditionFailed("etag_mismatch", "subscription was modified since it was read")
+)
+
+type ifMatchKey struct{}
+
+// WithIfMatch makes updates and deletes in ctx conditional on the current
+// ETag of the subscription, etags is the value of an If-Match header.
+func WithIfMatch(ctx context.Context, etags string) context.Context {
+	return context.WithValue(ctx, ifMatchKey{}, etags)
+}
+
 type SubscriptionService interface {
 	CreateSubscription(ctx context.Context, req *model.CreateSubscriptionRequest) (*model.Subscription, error)
+	// ImportSubscriptions creates the subscriptions of all requests or, if one
+	// of them is rejected, none.
+	ImportSubscriptions(ctx context.Context, reqs []*model.CreateSubscriptionRequest) ([]*model.Subscription, error)
 	GetSubscription(ctx context.Context, id string) (*model.Subscription, error)
-	UpdateSubscription(ctx context.Context, id string, req *model.UpdateSubscriptionRequest) error
-	DeleteSubscription(ctx context.Context, id string) error
+	// UpdateSubscription and DeleteSubscription return the subscription as
+	// updated or deleted.
+	UpdateSubscription(ctx context.Context, id string, req *model.UpdateSubscriptionRequest) (*model.Subscription, error)
+	DeleteSubscription(ctx context.Context, id string) (*model.Subscription, error)
 	ListSubscriptions(ctx context.Context, userID *string, serviceName *string) ([]*model.Subscription, error)
 	GetSummary(ctx context.Context, req *model.SummaryRequest) (*model.SubscriptionSummary, error)
 }
 
 type subscriptionService struct {
-	repo repository.SubscriptionRepository
+	repo  repository.SubscriptionRepository
+	users repository.UserRepository
 }
 
-func NewSubscriptionService(repo repository.SubscriptionRepository) SubscriptionService {
-	return &subscriptionService{repo: repo}
+func NewSubscriptionService(repo repository.SubscriptionRepository, users repository.UserRepository) SubscriptionService {
+	return &subscriptionService{repo: repo, users: users}
 }
 
-func (s *subscriptionService) CreateSubscription(ctx context.Context, req *model.CreateSubscriptionRequest) (*model.Subscription, error) {
-	log.Printf("Creating subscription for user %s", req.UserID)
+func (s *subscriptionService) CreateSubscription(ctx context.Context, req *model.CreateSubscriptionRequest) (_ *model.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.CreateSubscription",
+		trace.WithAttributes(attribute.String("user_id", req.UserID)))
+	defer func() { tracing.End(span, err) }()
 
-	subscription := &model.Subscription{
-		ServiceName: req.ServiceName,
-		Price:       req.Price,
-		UserID:      req.UserID,
-		StartDate:   req.StartDate,
-		EndDate:     req.EndDate,
+	slog.DebugContext(ctx, "creating subscription", "user_id", req.UserID)
+
+	subscription, err := s.newSubscription(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := s.repo.Create(ctx, subscription); err != nil {
-		log.Printf("Error creating subscription: %v", err)
+		slog.ErrorContext(ctx, "error creating subscription", "error", err)
 		return nil, err
 	}
 
-	log.Printf("Subscription created successfully with ID: %s", subscription.ID)
+	slog.InfoContext(ctx, "subscription created", "subscription_id", subscription.ID)
 	return subscription, nil
 }
 
-func (s *subscriptionService) GetSubscription(ctx context.Context, id string) (*model.Subscription, error) {
-	log.Printf("Getting subscription with ID: %s", id)
+func (s *subscriptionService) ImportSubscriptions(ctx context.Context, reqs []*model.CreateSubscriptionRequest) (_ []*model.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.ImportSubscriptions",
+		trace.WithAttributes(attribute.Int("count", len(reqs))))
+	defer func() { tracing.End(span, err) }()
+
+	subscriptions := make([]*model.Subscription, len(reqs))
+	for i, req := range reqs {
+		if subscriptions[i], err = s.newSubscription(ctx, req); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+
+	if err := s.repo.CreateMany(ctx, subscriptions); err != nil {
+		slog.ErrorContext(ctx, "error importing subscriptions", "error", err)
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "subscriptions created", "count", len(subscriptions))
+	return subscriptions, nil
+}
+
+// newSubscription checks that the caller may create the subscription of req
+// for an existing user.
+func (s *subscriptionService) newSubscription(ctx context.Context, req *model.CreateSubscriptionRequest) (*model.Subscription, error) {
+	if userID, restricted := auth.RestrictedUserID(ctx); restricted && userID != req.UserID {
+		return nil, ErrForbidden
+	}
+
+	if err := req.Normalize(); err != nil {
+		return nil, apperror.Wrap(apperror.ErrValidation, "invalid_date", "invalid date", err)
+	}
+
+	exists, err := s.users.Exists(ctx, req.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking user", "user_id", req.UserID, "error", err)
+		return nil, err
+	}
+	if !exists {
+		return nil, errUnknownUser
+	}
+
+	return &model.Subscription{
+		ServiceName: req.ServiceName,
+		Price:       req.Price,
+		UserID:      req.UserID,
+		StartDate:   req.StartDate,
+		EndDate:     req.EndDate,
+	}, nil
+}
+
+func (s *subscriptionService) GetSubscription(ctx context.Context, id string) (_ *model.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.GetSubscription",
+		trace.WithAttributes(attribute.String("subscription_id", id)))
+	defer func() { tracing.End(span, err) }()
 
 	subscription, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		log.Printf("Error getting subscription %s: %v", id, err)
+		slog.ErrorContext(ctx, "error getting subscription", "subscription_id", id, "error", err)
 		return nil, err
 	}
 
+	// Other users' subscriptions are reported as missing to avoid leaking
+	// which IDs exist.
+	if userID, restricted := auth.RestrictedUserID(ctx); restricted && userID != subscription.UserID {
+		return nil, errSubscriptionNotFound
+	}
+
 	return subscription, nil
 }
 
-func (s *subscriptionService) UpdateSubscription(ctx context.Context, id string, req *model.UpdateSubscriptionRequest) error {
-	log.Printf("Updating subscription with ID: %s", id)
+func (s *subscriptionService) UpdateSubscription(ctx context.Context, id string, req *model.UpdateSubscriptionRequest) (_ *model.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.UpdateSubscription",
+		trace.WithAttributes(attribute.String("subscription_id", id)))
+	defer func() { tracing.End(span, err) }()
 
-	if err := s.repo.Update(ctx, id, req); err != nil {
-		log.Printf("Error updating subscription %s: %v", id, err)
-		return err
+	if err := req.Normalize(); err != nil {
+		return nil, apperror.Wrap(apperror.ErrValidation, "invalid_date", "invalid date", err)
 	}
 
-	log.Printf("Subscription %s updated successfully", id)
-	return nil
+	subscription, err := s.repo.Update(ctx, id, req, func(current *model.Subscription) error {
+		if err := checkPreconditions(ctx, current); err != nil {
+			return err
+		}
+		return checkDates(current, req)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error updating subscription", "subscription_id", id, "error", err)
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "subscription updated", "subscription_id", id)
+	return subscription, nil
 }
 
-func (s *subscriptionService) DeleteSubscription(ctx context.Context, id string) error {
-	log.Printf("Deleting subscription with ID: %s", id)
+func (s *subscriptionService) DeleteSubscription(ctx context.Context, id string) (_ *model.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.DeleteSubscription",
+		trace.WithAttributes(attribute.String("subscription_id", id)))
+	defer func() { tracing.End(span, err) }()
 
-	if err := s.repo.Delete(ctx, id); err != nil {
-		log.Printf("Error deleting subscription %s: %v", id, err)
-		return err
+	subscription, err := s.repo.Delete(ctx, id, func(current *model.Subscription) error {
+		return checkPreconditions(ctx, current)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error deleting subscription", "subscription_id", id, "error", err)
+		return nil, err
 	}
 
-	log.Printf("Subscription %s deleted successfully", id)
-	return nil
+	slog.InfoContext(ctx, "subscription deleted", "subscription_id", id)
+	return subscription, nil
 }
 
-func (s *subscriptionService) ListSubscriptions(ctx context.Context, userID *string, serviceName *string) ([]*model.Subscription, error) {
-	log.Printf("Listing subscriptions, filters - userID: %v, serviceName: %v", userID, serviceName)
+func (s *subscriptionService) ListSubscriptions(ctx context.Context, userID *string, serviceName *string) (_ []*model.Subscription, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.ListSubscriptions")
+	defer func() { tracing.End(span, err) }()
+
+	if restrictedID, restricted := auth.RestrictedUserID(ctx); restricted {
+		if userID != nil && *userID != restrictedID {
+			return nil, ErrForbidden
+		}
+		userID = &restrictedID
+	}
 
 	subscriptions, err := s.repo.List(ctx, userID, serviceName)
 	if err != nil {
-		log.Printf("Error listing subscriptions: %v", err)
+		slog.ErrorContext(ctx, "error listing subscriptions", "error", err)
 		return nil, err
 	}
 
-	log.Printf("Found %d subscriptions", len(subscriptions))
+	slog.DebugContext(ctx, "subscriptions listed", "count", len(subscriptions))
 	return subscriptions, nil
 }
 
-func (s *subscriptionService) GetSummary(ctx context.Context, req *model.SummaryRequest) (*model.SubscriptionSummary, error) {
-	log.Printf("Getting summary for period %s to %s", req.StartPeriod, req.EndPeriod)
+func (s *subscriptionService) GetSummary(ctx context.Context, req *model.SummaryRequest) (_ *model.SubscriptionSummary, err error) {
+	ctx, span := tracer.Start(ctx, "SubscriptionService.GetSummary",
+		trace.WithAttributes(attribute.String("start_period", req.StartPeriod), attribute.String("end_period", req.EndPeriod)))
+	defer func() { tracing.End(span, err) }()
+
+	if restrictedID, restricted := auth.RestrictedUserID(ctx); restricted {
+		if req.UserID != nil && *req.UserID != restrictedID {
+			return nil, ErrForbidden
+		}
+		req.UserID = &restrictedID
+	}
+
+	if err := req.Normalize(); err != nil {
+		return nil, apperror.Wrap(apperror.ErrValidation, "invalid_date", "invalid period", err)
+	}
 
 	summary, err := s.repo.GetSummary(ctx, req)
 	if err != nil {
-		log.Printf("Error getting summary: %v", err)
+		slog.ErrorContext(ctx, "error calculating summary", "error", err)
 		return nil, err
 	}
 
-	log.Printf("Summary calculated: total cost %d, count %d", summary.TotalCost, summary.Count)
+	slog.DebugContext(ctx, "summary calculated", "total_cost", summary.TotalCost, "count", summary.Count)
 	return summary, nil
 }
+
+// checkPreconditions makes sure a restricted caller only modifies their own
+// subscriptions and that the If-Match condition of ctx, if any, holds for
+// current. It runs on the locked row, so a concurrent change cannot slip in
+// between the check and the write.
+func checkPreconditions(ctx context.Context, current *model.Subscription) error {
+	// Other users' subscriptions are reported as missing, as by
+	// GetSubscription.
+	if userID, restricted := auth.RestrictedUserID(ctx); restricted && userID != current.UserID {
+		return errSubscriptionNotFound
+	}
+
+	if etags, conditional := ctx.Value(ifMatchKey{}).(string); conditional && !matchETag(etags, current.ETag()) {
+		return errETagMismatch
+	}
+	return nil
+}
+
+// checkDates makes sure that an update of only one of the dates keeps the end
+// date not before the start date, updates of both are checked on binding.
+func checkDates(current *model.Subscription, req *model.UpdateSubscriptionRequest) error {
+	if (req.StartDate == nil) == (req.EndDate == nil) {
+		return nil
+	}
+
+	startDate, endDate := current.StartDate, current.EndDate
+	if req.StartDate != nil {
+		startDate = *req.StartDate
+	} else {
+		endDate = req.EndDate
+	}
+	if endDate == nil {
+		return nil
+	}
+
+	start, startErr := model.ParseMonth(startDate)
+	end, endErr := model.ParseMonth(*endDate)
+	if startErr == nil && endErr == nil && end.Before(start) {
+		field := "end_date"
+		if req.StartDate != nil {
+			field = "start_date"
+		}
+		return apperror.InvalidFields(apperror.FieldError{
+			Field:   field,
+			Code:    "end_before_start",
+			Message: "end_date must not be before start_date",
+		})
+	}
+	return nil
+}
+
+func matchETag(etags, etag string) bool {
+	for _, candidate := range strings.Split(etags, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tenant"
+)
+
+const (
+	aliceID = "60601fee-2bf1-4721-ae6f-7636e79a0cba"
+	bobID   = "7c1a5b7e-3f0e-4f9a-9d53-0b8a2e6d4c11"
+	ghostID = "00000000-0000-4000-8000-000000000000"
+)
+
+func newMemorySubscriptionService(t *testing.T) (context.Context, SubscriptionService) {
+	t.Helper()
+
+	store := repository.NewMemoryStore()
+	users := repository.NewMemoryUserRepository(store)
+	ctx := tenant.WithID(context.Background(), tenant.DefaultID)
+	for _, id := range []string{aliceID, bobID} {
+		if err := users.Create(ctx, &model.User{ID: id}); err != nil {
+			t.Fatalf("creating user %s: %v", id, err)
+		}
+	}
+
+	return ctx, NewSubscriptionService(repository.NewMemorySubscriptionRepository(store), users)
+}
+
+func createSubscription(t *testing.T, ctx context.Context, svc SubscriptionService, req model.CreateSubscriptionRequest) *model.Subscription {
+	t.Helper()
+	subscription, err := svc.CreateSubscription(ctx, &req)
+	if err != nil {
+		t.Fatalf("CreateSubscription(%+v): %v", req, err)
+	}
+	return subscription
+}
+
+// errorCode returns the code of a domain error, "" for any other error.
+func errorCode(err error) string {
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return ""
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSubscriptionServiceCreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       model.CreateSubscriptionRequest
+		kind      error
+		code      string
+		startDate string
+	}{
+		{
+			name:      "canonical dates",
+			req:       model.CreateSubscriptionRequest{ServiceName: "Yandex Plus", Price: 400, UserID: aliceID, StartDate: "2025-07"},
+			startDate: "2025-07",
+		},
+		{
+			name:      "legacy dates are normalized",
+			req:       model.CreateSubscriptionRequest{ServiceName: "Yandex Plus", Price: 400, UserID: aliceID, StartDate: "07-2025", EndDate: ptr("12-2025")},
+			startDate: "2025-07",
+		},
+		{
+			name: "unknown user",
+			req:  model.CreateSubscriptionRequest{ServiceName: "Yandex Plus", Price: 400, UserID: ghostID, StartDate: "2025-07"},
+			kind: apperror.ErrValidation,
+			code: "unknown_user",
+		},
+		{
+			name: "invalid date",
+			req:  model.CreateSubscriptionRequest{ServiceName: "Yandex Plus", Price: 400, UserID: aliceID, StartDate: "2025-13"},
+			kind: apperror.ErrValidation,
+			code: "invalid_date",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, svc := newMemorySubscriptionService(t)
+
+			subscription, err := svc.CreateSubscription(ctx, &tt.req)
+			if tt.kind != nil {
+				if !errors.Is(err, tt.kind) || errorCode(err) != tt.code {
+					t.Fatalf("err = %v (code %q), want %v with code %q", err, errorCode(err), tt.kind, tt.code)
+				}
+				list, _ := svc.ListSubscriptions(ctx, nil, nil)
+				if len(list) != 0 {
+					t.Errorf("rejected subscription was stored")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateSubscription: %v", err)
+			}
+
+			got, err := svc.GetSubscription(ctx, subscription.ID)
+			if err != nil {
+				t.Fatalf("GetSubscription: %v", err)
+			}
+			if got.StartDate != tt.startDate || got.UserID != tt.req.UserID || got.TenantID != tenant.DefaultID {
+				t.Errorf("got %+v, want start date %s of user %s in the default tenant", got, tt.startDate, tt.req.UserID)
+			}
+		})
+	}
+}
+
+func TestSubscriptionServiceUpdateAndDelete(t *testing.T) {
+	ctx, svc := newMemorySubscriptionService(t)
+	subscription := createSubscription(t, ctx, svc, model.CreateSubscriptionRequest{
+		ServiceName: "Yandex Plus", Price: 400, UserID: aliceID, StartDate: "2025-03", EndDate: ptr("2025-09"),
+	})
+
+	tests := []struct {
+		name  string
+		req   model.UpdateSubscriptionRequest
+		code  string
+		check func(t *testing.T, got *model.Subscription)
+	}{
+		{
+			name: "price",
+			req:  model.UpdateSubscriptionRequest{Price: ptr(500)},
+			check: func(t *testing.T, got *model.Subscription) {
+				if got.Price != 500 {
+					t.Errorf("price = %d, want 500", got.Price)
+				}
+			},
+		},
+		{
+			name: "legacy end date",
+			req:  model.UpdateSubscriptionRequest{EndDate: ptr("10-2025")},
+			check: func(t *testing.T, got *model.Subscription) {
+				if got.EndDate == nil || *got.EndDate != "2025-10" {
+					t.Errorf("end date = %v, want 2025-10", got.EndDate)
+				}
+			},
+		},
+		{
+			name: "start date after the stored end date",
+			req:  model.UpdateSubscriptionRequest{StartDate: ptr("2026-01")},
+			code: "validation_failed",
+		},
+		{
+			name: "no fields",
+			req:  model.UpdateSubscriptionRequest{},
+			code: "no_fields",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.UpdateSubscription(ctx, subscription.ID, &tt.req)
+			if tt.code != "" {
+				if errorCode(err) != tt.code {
+					t.Fatalf("err = %v, want code %q", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateSubscription: %v", err)
+			}
+
+			got, err := svc.GetSubscription(ctx, subscription.ID)
+			if err != nil {
+				t.Fatalf("GetSubscription: %v", err)
+			}
+			tt.check(t, got)
+		})
+	}
+
+	if _, err := svc.DeleteSubscription(ctx, subscription.ID); err != nil {
+		t.Fatalf("DeleteSubscription: %v", err)
+	}
+	if _, err := svc.GetSubscription(ctx, subscription.ID); !errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("GetSubscription after delete: err = %v, want not found", err)
+	}
+	if _, err := svc.DeleteSubscription(ctx, subscription.ID); !errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("second DeleteSubscription: err = %v, want not found", err)
+	}
+}
+
+func TestSubscriptionServiceIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch func(etag string) string
+		ok      bool
+	}{
+		{"current etag", func(etag string) string { return etag }, true},
+		{"wildcard", func(string) string { return "*" }, true},
+		{"one of several", func(etag string) string { return `"stale", ` + etag }, true},
+		{"stale etag", func(string) string { return `"stale"` }, false},
+	}
+
+	operations := []struct {
+		name string
+		run  func(ctx context.Context, svc SubscriptionService, id string) error
+	}{
+		{"update", func(ctx context.Context, svc SubscriptionService, id string) error {
+			_, err := svc.UpdateSubscription(ctx, id, &model.UpdateSubscriptionRequest{Price: ptr(1)})
+			return err
+		}},
+		{"delete", func(ctx context.Context, svc SubscriptionService, id string) error {
+			_, err := svc.DeleteSubscription(ctx, id)
+			return err
+		}},
+	}
+
+	for _, op := range operations {
+		for _, tt := range tests {
+			t.Run(op.name+"/"+tt.name, func(t *testing.T) {
+				ctx, svc := newMemorySubscriptionService(t)
+				created := createSubscription(t, ctx, svc, model.CreateSubscriptionRequest{
+					ServiceName: "Netflix", Price: 800, UserID: bobID, StartDate: "2025-01",
+				})
+				current, err := svc.GetSubscription(ctx, created.ID)
+				if err != nil {
+					t.Fatalf("GetSubscription: %v", err)
+				}
+
+				err = op.run(WithIfMatch(ctx, tt.ifMatch(current.ETag())), svc, created.ID)
+				if tt.ok && err != nil {
+					t.Fatalf("err = %v, want success", err)
+				}
+				if !tt.ok {
+					if !errors.Is(err, apperror.ErrPreconditionFailed) {
+						t.Fatalf("err = %v, want precondition failed", err)
+					}
+					after, err := svc.GetSubscription(ctx, created.ID)
+					if err != nil || after.ETag() != current.ETag() {
+						t.Errorf("subscription changed despite failed precondition: %+v, %v", after, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSubscriptionServiceIfMatchIsAtomic(t *testing.T) {
+	ctx, svc := newMemorySubscriptionService(t)
+	created := createSubscription(t, ctx, svc, model.CreateSubscriptionRequest{
+		ServiceName: "Netflix", Price: 800, UserID: bobID, StartDate: "2025-01",
+	})
+	current, err := svc.GetSubscription(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetSubscription: %v", err)
+	}
+
+	ctx = WithIfMatch(ctx, current.ETag())
+	errs := make(chan error, 10)
+	for price := range 10 {
+		go func() {
+			_, err := svc.UpdateSubscription(ctx, created.ID, &model.UpdateSubscriptionRequest{Price: ptr(price + 1)})
+			errs <- err
+		}()
+	}
+
+	updated := 0
+	for range 10 {
+		switch err := <-errs; {
+		case err == nil:
+			updated++
+		case !errors.Is(err, apperror.ErrPreconditionFailed):
+			t.Errorf("err = %v, want precondition failed", err)
+		}
+	}
+	if updated != 1 {
+		t.Errorf("%d updates with the same If-Match succeeded, want 1", updated)
+	}
+}
+
+func TestSubscriptionServiceSummary(t *testing.T) {
+	ctx, svc := newMemorySubscriptionService(t)
+	for _, req := range []model.CreateSubscriptionRequest{
+		{ServiceName: "Yandex Plus", Price: 400, UserID: aliceID, StartDate: "2025-01", EndDate: ptr("2025-03")},
+		{ServiceName: "Netflix", Price: 800, UserID: aliceID, StartDate: "2025-03"},
+		{ServiceName: "Netflix", Price: 700, UserID: bobID, StartDate: "2025-06", EndDate: ptr("2025-06")},
+	} {
+		createSubscription(t, ctx, svc, req)
+	}
+
+	tests := []struct {
+		name    string
+		req     model.SummaryRequest
+		total   int
+		count   int
+		invalid bool
+	}{
+		{"whole year", model.SummaryRequest{StartPeriod: "2025-01", EndPeriod: "2025-12"}, 1900, 3, false},
+		{"single month", model.SummaryRequest{StartPeriod: "2025-02", EndPeriod: "2025-02"}, 400, 1, false},
+		{"touching start and end months", model.SummaryRequest{StartPeriod: "2025-03", EndPeriod: "2025-03"}, 1200, 2, false},
+		{"after everything ended but open ones", model.SummaryRequest{StartPeriod: "2025-07", EndPeriod: "2026-12"}, 800, 1, false},
+		{"before everything", model.SummaryRequest{StartPeriod: "2024-01", EndPeriod: "2024-12"}, 0, 0, false},
+		{"legacy periods", model.SummaryRequest{StartPeriod: "06-2025", EndPeriod: "06-2025"}, 1500, 2, false},
+		{"by user", model.SummaryRequest{UserID: ptr(aliceID), StartPeriod: "2025-01", EndPeriod: "2025-12"}, 1200, 2, false},
+		{"by service", model.SummaryRequest{ServiceName: ptr("Netflix"), StartPeriod: "2025-01", EndPeriod: "2025-12"}, 1500, 2, false},
+		{"invalid period", model.SummaryRequest{StartPeriod: "2025-00", EndPeriod: "2025-12"}, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := svc.GetSummary(ctx, &tt.req)
+			if tt.invalid {
+				if !errors.Is(err, apperror.ErrValidation) {
+					t.Fatalf("err = %v, want validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSummary: %v", err)
+			}
+			if summary.TotalCost != tt.total || summary.Count != tt.count {
+				t.Errorf("summary = %+v, want total %d over %d subscriptions", summary, tt.total, tt.count)
+			}
+		})
+	}
+}
+
+func TestSubscriptionServiceImport(t *testing.T) {
+	tests := []struct {
+		name  string
+		users []string
+		code  string
+	}{
+		{"all users exist", []string{aliceID, bobID}, ""},
+		{"one unknown user", []string{aliceID, ghostID}, "unknown_user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, svc := newMemorySubscriptionService(t)
+
+			var reqs []*model.CreateSubscriptionRequest
+			for _, userID := range tt.users {
+				reqs = append(reqs, &model.CreateSubscriptionRequest{ServiceName: "Spotify", Price: 300, UserID: userID, StartDate: "2025-05"})
+			}
+
+			imported, err := svc.ImportSubscriptions(ctx, reqs)
+			list, listErr := svc.ListSubscriptions(ctx, nil, nil)
+			if listErr != nil {
+				t.Fatalf("ListSubscriptions: %v", listErr)
+			}
+
+			if tt.code != "" {
+				if errorCode(err) != tt.code {
+					t.Fatalf("err = %v, want code %q", err, tt.code)
+				}
+				if len(list) != 0 {
+					t.Errorf("%d subscriptions stored by a failed import, want none", len(list))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ImportSubscriptions: %v", err)
+			}
+			if len(imported) != len(reqs) || len(list) != len(reqs) {
+				t.Errorf("imported %d, stored %d, want %d", len(imported), len(list), len(reqs))
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"subscription-service/internal/auth"
+	"subscription-service/internal/metrics"
+	"subscription-service/internal/model"
+	"subscription-service/internal/tenant"
+	"subscription-service/pkg/database"
+)
+
+// SummaryInvalidationChannel is the Postgres channel notified with
+// "tenant_id:user_id" whenever a subscription of the user changes.
+const SummaryInvalidationChannel = "summary_invalidation"
+
+type summaryKey struct {
+	tenantID    string
+	userID      string
+	allUsers    bool
+	serviceName string
+	allServices bool
+	startPeriod string
+	endPeriod   string
+}
+
+type summaryEntry struct {
+	key       summaryKey
+	summary   model.SubscriptionSummary
+	expiresAt time.Time
+}
+
+// SummaryCache keeps summaries for at most ttl and evicts the least recently
+// used beyond maxEntries. A change of a user's subscriptions drops the
+// summaries of that user and those over all users of the tenant.
+type SummaryCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[summaryKey]*list.Element
+	lru     *list.List
+	// version changes on every invalidation, a summary computed across one
+	// is not cached.
+	version uint64
+}
+
+func NewSummaryCache(ttl time.Duration, maxEntries int) *SummaryCache {
+	return &SummaryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[summaryKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (c *SummaryCache) get(key summaryKey) (*model.SubscriptionSummary, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, c.version, false
+	}
+	entry := elem.Value.(*summaryEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(elem)
+		return nil, c.version, false
+	}
+
+	c.lru.MoveToFront(elem)
+	summary := entry.summary
+	return &summary, c.version, true
+}
+
+// put caches summary unless the cache was invalidated since version was read.
+func (c *SummaryCache) put(key summaryKey, summary *model.SubscriptionSummary, version uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	for c.lru.Len() >= c.maxEntries && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+
+	c.entries[key] = c.lru.PushFront(&summaryEntry{
+		key:       key,
+		summary:   *summary,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+}
+
+func (c *SummaryCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*summaryEntry).key)
+}
+
+// Invalidate drops the summaries affected by a change of the subscriptions
+// of userID, or of any user of the tenant when userID is empty.
+func (c *SummaryCache) Invalidate(tenantID, userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	for key, elem := range c.entries {
+		if key.tenantID == tenantID && (userID == "" || key.allUsers || strings.EqualFold(key.userID, userID)) {
+			c.remove(elem)
+		}
+	}
+}
+
+// InvalidateNotification handles a notification on
+// SummaryInvalidationChannel.
+func (c *SummaryCache) InvalidateNotification(payload string) {
+	tenantID, userID, ok := strings.Cut(payload, ":")
+	if !ok {
+		slog.Warn("malformed summary invalidation", "payload", payload)
+		c.Reset()
+		return
+	}
+	c.Invalidate(tenantID, userID)
+}
+
+// Reset drops all summaries.
+func (c *SummaryCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	c.entries = make(map[summaryKey]*list.Element)
+	c.lru.Init()
+}
+
+type cachedSubscriptionService struct {
+	SubscriptionService
+	cache *SummaryCache
+}
+
+// NewCachedSubscriptionService serves summaries of next from cache. Writes
+// through the returned service invalidate the cache right away, writes of
+// other replicas and commands arrive through SummaryInvalidationChannel.
+func NewCachedSubscriptionService(next SubscriptionService, cache *SummaryCache) SubscriptionService {
+	return &cachedSubscriptionService{SubscriptionService: next, cache: cache}
+}
+
+func (s *cachedSubscriptionService) CreateSubscription(ctx context.Context, req *model.CreateSubscriptionRequest) (*model.Subscription, error) {
+	subscription, err := s.SubscriptionService.CreateSubscription(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Invalidate(tenant.FromContext(ctx), subscription.UserID)
+	return subscription, nil
+}
+
+func (s *cachedSubscriptionService) ImportSubscriptions(ctx context.Context, reqs []*model.CreateSubscriptionRequest) ([]*model.Subscription, error) {
+	subscriptions, err := s.SubscriptionService.ImportSubscriptions(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, subscription := range subscriptions {
+		s.cache.Invalidate(tenant.FromContext(ctx), subscription.UserID)
+	}
+	return subscriptions, nil
+}
+
+func (s *cachedSubscriptionService) UpdateSubscription(ctx context.Context, id string, req *model.UpdateSubscriptionRequest) (*model.Subscription, error) {
+	subscription, err := s.SubscriptionService.UpdateSubscription(ctx, id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Invalidate(tenant.FromContext(ctx), subscription.UserID)
+	return subscription, nil
+}
+
+func (s *cachedSubscriptionService) DeleteSubscription(ctx context.Context, id string) (*model.Subscription, error) {
+	subscription, err := s.SubscriptionService.DeleteSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Invalidate(tenant.FromContext(ctx), subscription.UserID)
+	return subscription, nil
+}
+
+func (s *cachedSubscriptionService) GetSummary(ctx context.Context, req *model.SummaryRequest) (*model.SubscriptionSummary, error) {
+	// The key has to cover what the summary is computed over, so the
+	// restriction and normalization are applied here as well. Requests they
+	// reject are left to next.
+	if restrictedID, restricted := auth.RestrictedUserID(ctx); restricted {
+		if req.UserID != nil && *req.UserID != restrictedID {
+			return s.SubscriptionService.GetSummary(ctx, req)
+		}
+		req.UserID = &restrictedID
+	}
+	if err := req.Normalize(); err != nil {
+		return s.SubscriptionService.GetSummary(ctx, req)
+	}
+
+	key := summaryKey{
+		tenantID:    tenant.FromContext(ctx),
+		allUsers:    req.UserID == nil,
+		allServices: req.ServiceName == nil,
+		startPeriod: req.StartPeriod,
+		endPeriod:   req.EndPeriod,
+	}
+	if req.UserID != nil {
+		key.userID = *req.UserID
+	}
+	if req.ServiceName != nil {
+		key.serviceName = *req.ServiceName
+	}
+
+	summary, version, ok := s.cache.get(key)
+	metrics.ObserveSummaryCache(ok)
+	if ok {
+		return summary, nil
+	}
+
+	// A replica may not have applied the write whose invalidation bumped the
+	// version yet, and a stale summary would then be cached as current.
+	summary, err := s.SubscriptionService.GetSummary(database.WithPrimary(ctx), req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.put(key, summary, version)
+	return summary, nil
+}
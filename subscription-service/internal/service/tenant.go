@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tenant"
+)
+
+type TenantService interface {
+	CreateTenant(ctx context.Context, req *model.CreateTenantRequest) (*model.Tenant, error)
+	ListTenants(ctx context.Context) ([]*model.Tenant, error)
+}
+
+type tenantService struct {
+	repo repository.TenantRepository
+}
+
+func NewTenantService(repo repository.TenantRepository) TenantService {
+	return &tenantService{repo: repo}
+}
+
+func (s *tenantService) CreateTenant(ctx context.Context, req *model.CreateTenantRequest) (*model.Tenant, error) {
+	if !tenant.ValidID(req.ID) {
+		return nil, apperror.Validation("invalid_tenant_id", "tenant id must match [a-z0-9][a-z0-9_-]*")
+	}
+
+	t := &model.Tenant{ID: req.ID, Name: req.Name}
+	if err := s.repo.Create(ctx, t); err != nil {
+		slog.ErrorContext(ctx, "error creating tenant", "tenant_id", req.ID, "error", err)
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "tenant created", "tenant_id", t.ID)
+	return t, nil
+}
+
+func (s *tenantService) ListTenants(ctx context.Context) ([]*model.Tenant, error) {
+	return s.repo.List(ctx)
+}
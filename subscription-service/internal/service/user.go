@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+)
+
+type UserService interface {
+	CreateUser(ctx context.Context, req *model.CreateUserRequest) (*model.User, error)
+	GetUser(ctx context.Context, id string) (*model.User, error)
+	UpdateUser(ctx context.Context, id string, req *model.UpdateUserRequest) error
+	DeleteUser(ctx context.Context, id string) error
+	ListUsers(ctx context.Context) ([]*model.User, error)
+	PurgeUser(ctx context.Context, id string) error
+}
+
+type userService struct {
+	repo repository.UserRepository
+}
+
+func NewUserService(repo repository.UserRepository) UserService {
+	return &userService{repo: repo}
+}
+
+func (s *userService) CreateUser(ctx context.Context, req *model.CreateUserRequest) (*model.User, error) {
+	user := &model.User{
+		Name:  req.Name,
+		Email: req.Email,
+	}
+	if req.ID != nil {
+		user.ID = *req.ID
+	}
+
+	if err := s.repo.Create(ctx, user); err != nil {
+		slog.ErrorContext(ctx, "error creating user", "error", err)
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "user created", "user_id", user.ID)
+	return user, nil
+}
+
+func (s *userService) GetUser(ctx context.Context, id string) (*model.User, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *userService) UpdateUser(ctx context.Context, id string, req *model.UpdateUserRequest) error {
+	if err := s.repo.Update(ctx, id, req); err != nil {
+		slog.ErrorContext(ctx, "error updating user", "user_id", id, "error", err)
+		return err
+	}
+
+	slog.InfoContext(ctx, "user updated", "user_id", id)
+	return nil
+}
+
+func (s *userService) DeleteUser(ctx context.Context, id string) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		slog.ErrorContext(ctx, "error deleting user", "user_id", id, "error", err)
+		return err
+	}
+
+	slog.InfoContext(ctx, "user deleted", "user_id", id)
+	return nil
+}
+
+func (s *userService) ListUsers(ctx context.Context) ([]*model.User, error) {
+	return s.repo.List(ctx)
+}
+
+// PurgeUser irreversibly erases the user and all data referring to them.
+func (s *userService) PurgeUser(ctx context.Context, id string) error {
+	subscriptions, err := s.repo.Purge(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "error purging user", "user_id", id, "error", err)
+		return err
+	}
+
+	slog.InfoContext(ctx, "user purged", "user_id", id, "subscriptions", subscriptions)
+	return nil
+}
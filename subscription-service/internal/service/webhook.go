@@ -0,0 +1,370 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"subscription-service/internal/config"
+	"subscription-service/internal/event"
+	"subscription-service/internal/health"
+	"subscription-service/internal/model"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tenant"
+)
+
+const (
+	HeaderWebhookID        = "X-Webhook-ID"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, req *model.CreateWebhookRequest) (*model.CreatedWebhook, error)
+	GetWebhook(ctx context.Context, id string) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]*model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	ListDeliveries(ctx context.Context, webhookID string) ([]*model.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, webhookID, deliveryID string) (*model.WebhookDelivery, error)
+	event.EventPublisher
+}
+
+type webhookService struct {
+	repo repository.WebhookRepository
+}
+
+func NewWebhookService(repo repository.WebhookRepository) WebhookService {
+	return &webhookService{repo: repo}
+}
+
+func (s *webhookService) CreateWebhook(ctx context.Context, req *model.CreateWebhookRequest) (*model.CreatedWebhook, error) {
+	secret := req.Secret
+	if secret == "" {
+		generated, err := generateSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+
+	webhook := &model.Webhook{
+		URL:    req.URL,
+		Secret: secret,
+		Events: req.Events,
+		Active: true,
+	}
+
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		slog.ErrorContext(ctx, "error creating webhook", "error", err)
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "webhook created", "webhook_id", webhook.ID)
+	return &model.CreatedWebhook{Webhook: *webhook, Secret: secret}, nil
+}
+
+func (s *webhookService) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *webhookService) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *webhookService) DeleteWebhook(ctx context.Context, id string) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		slog.ErrorContext(ctx, "error deleting webhook", "webhook_id", id, "error", err)
+		return err
+	}
+
+	slog.InfoContext(ctx, "webhook deleted", "webhook_id", id)
+	return nil
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, webhookID string) ([]*model.WebhookDelivery, error) {
+	return s.repo.ListDeliveries(ctx, webhookID)
+}
+
+// ReplayDelivery enqueues a fresh delivery with the original payload, the
+// replayed entry stays in the log untouched.
+func (s *webhookService) ReplayDelivery(ctx context.Context, webhookID, deliveryID string) (*model.WebhookDelivery, error) {
+	original, err := s.repo.GetDelivery(ctx, webhookID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &model.WebhookDelivery{
+		WebhookID: original.WebhookID,
+		EventID:   original.EventID,
+		EventType: original.EventType,
+		Payload:   original.Payload,
+		Status:    model.DeliveryStatusPending,
+		ReplayOf:  &original.ID,
+	}
+
+	if _, err := s.repo.CreateDelivery(ctx, delivery); err != nil {
+		slog.ErrorContext(ctx, "error replaying delivery", "delivery_id", deliveryID, "error", err)
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "delivery replayed", "delivery_id", deliveryID, "new_delivery_id", delivery.ID)
+	return delivery, nil
+}
+
+// Publish records a pending delivery for every active webhook subscribed to
+// the event, the actual HTTP calls are made by DeliveryWorker. The outbox
+// publishes an event again when another publisher failed, webhooks that
+// already have a delivery of it are skipped.
+func (s *webhookService) Publish(ctx context.Context, envelope event.Envelope) error {
+	ctx = tenant.WithID(ctx, envelope.TenantID)
+
+	webhooks, err := s.repo.ListByEvent(ctx, envelope.Type)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("error encoding event payload: %w", err)
+	}
+
+	enqueued := 0
+	for _, webhook := range webhooks {
+		delivery := &model.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   envelope.ID,
+			EventType: envelope.Type,
+			Payload:   payload,
+			Status:    model.DeliveryStatusPending,
+		}
+		created, err := s.repo.CreateDelivery(ctx, delivery)
+		if err != nil {
+			return fmt.Errorf("error enqueueing delivery for webhook %s: %w", webhook.ID, err)
+		}
+		if created {
+			enqueued++
+		}
+	}
+
+	slog.InfoContext(ctx, "event enqueued for webhooks", "event_id", envelope.ID, "event_type", envelope.Type,
+		"webhooks", enqueued, "already_enqueued", len(webhooks)-enqueued)
+	return nil
+}
+
+// SignPayload computes the value of the X-Webhook-Signature header. Receivers
+// verify it by computing HMAC-SHA256 over "<timestamp>.<body>" with their secret.
+func SignPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+type DeliveryWorker struct {
+	repo   repository.WebhookRepository
+	client *http.Client
+	cfg    config.WebhookConfig
+
+	heartbeat health.Heartbeat
+}
+
+func NewDeliveryWorker(repo repository.WebhookRepository, cfg config.WebhookConfig) *DeliveryWorker {
+	var allowed []netip.Prefix
+	for _, network := range cfg.AllowedNetworks {
+		if prefix, err := netip.ParsePrefix(network); err == nil {
+			allowed = append(allowed, prefix)
+		}
+	}
+
+	return &DeliveryWorker{
+		repo:   repo,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: receiverTransport(allowed)},
+		cfg:    cfg,
+	}
+}
+
+// errReceiverAddress is returned for receivers that resolve to an address
+// inside the deployment.
+var errReceiverAddress = errors.New("webhook receiver address is not allowed")
+
+// receiverTransport connects only to addresses checkReceiverAddress accepts.
+// The check runs on the address being dialed, after DNS resolution, so that
+// neither a hostname nor a redirect can lead a delivery into the deployment.
+// Proxies are not used, the check would only see the proxy.
+func receiverTransport(allowed []netip.Prefix) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			return checkReceiverAddress(address, allowed)
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// checkReceiverAddress refuses loopback, private, link-local, multicast and
+// unspecified addresses, which include cloud metadata endpoints, unless they
+// are in allowed.
+func checkReceiverAddress(address string, allowed []netip.Prefix) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := addrPort.Addr().Unmap()
+	for _, prefix := range allowed {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", errReceiverAddress, ip)
+	}
+	return nil
+}
+
+func (w *DeliveryWorker) Run(ctx context.Context) {
+	slog.Info("webhook delivery worker started", "poll_interval", w.cfg.PollInterval)
+	w.heartbeat.Beat()
+	defer w.heartbeat.Stop()
+
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("webhook delivery worker stopped")
+			return
+		case <-ticker.C:
+			w.processBatch(ctx)
+			w.heartbeat.Beat()
+		}
+	}
+}
+
+// Health reports the worker as unhealthy when its loop has stalled.
+func (w *DeliveryWorker) Health(staleAfter time.Duration) health.Check {
+	return w.heartbeat.Check(staleAfter)
+}
+
+func (w *DeliveryWorker) processBatch(ctx context.Context) {
+	// The lease must outlive a full attempt, otherwise another worker could
+	// pick the delivery up while we are still waiting for the receiver.
+	deliveries, err := w.repo.ClaimDueDeliveries(ctx, w.cfg.BatchSize, 2*w.cfg.Timeout)
+	if err != nil {
+		slog.ErrorContext(ctx, "error claiming webhook deliveries", "error", err)
+		return
+	}
+
+	// See OutboxRelay.processBatch, a started delivery is always completed.
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		w.deliver(context.WithoutCancel(ctx), delivery)
+		w.heartbeat.Beat()
+	}
+}
+
+func (w *DeliveryWorker) deliver(ctx context.Context, delivery *model.WebhookDelivery) {
+	ctx = tenant.WithID(ctx, delivery.TenantID)
+
+	webhook, err := w.repo.GetByID(ctx, delivery.WebhookID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error loading webhook for delivery", "webhook_id", delivery.WebhookID, "delivery_id", delivery.ID, "error", err)
+		return
+	}
+
+	delivery.Attempts++
+	statusCode, err := w.send(ctx, webhook, delivery)
+	if statusCode != 0 {
+		delivery.ResponseStatus = &statusCode
+	}
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		delivery.Status = model.DeliveryStatusSucceeded
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		delivery.LastError = nil
+	case delivery.Attempts >= w.cfg.MaxAttempts:
+		errMsg := err.Error()
+		delivery.Status = model.DeliveryStatusFailed
+		delivery.LastError = &errMsg
+		delivery.NextAttemptAt = nil
+		slog.ErrorContext(ctx, "delivery failed permanently",
+			"delivery_id", delivery.ID, "url", webhook.URL, "attempts", delivery.Attempts, "error", err)
+	default:
+		errMsg := err.Error()
+		next := now.Add(backoff(w.cfg.InitialBackoff, w.cfg.MaxBackoff, delivery.Attempts))
+		delivery.LastError = &errMsg
+		delivery.NextAttemptAt = &next
+		slog.WarnContext(ctx, "delivery failed, retrying",
+			"delivery_id", delivery.ID, "url", webhook.URL, "attempt", delivery.Attempts,
+			"next_attempt_at", next, "error", err)
+	}
+
+	if err := w.repo.UpdateDelivery(ctx, delivery); err != nil {
+		slog.ErrorContext(ctx, "error saving delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+func (w *DeliveryWorker) send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", event.ContentType)
+	req.Header.Set(HeaderWebhookID, delivery.ID)
+	req.Header.Set(HeaderWebhookEvent, delivery.EventType)
+	req.Header.Set(HeaderWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderWebhookSignature, SignPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
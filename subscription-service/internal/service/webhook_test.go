@@ -0,0 +1,396 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"subscription-service/internal/config"
+	"subscription-service/internal/event"
+	"subscription-service/internal/model"
+)
+
+// webhookRepoStub keeps webhooks and deliveries in memory and, like the
+// unique index of webhook_deliveries, creates one delivery per webhook and
+// event besides replays.
+type webhookRepoStub struct {
+	mu         sync.Mutex
+	webhooks   []*model.Webhook
+	deliveries []*model.WebhookDelivery
+}
+
+func (r *webhookRepoStub) Create(_ context.Context, webhook *model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook.ID = fmt.Sprintf("webhook-%d", len(r.webhooks)+1)
+	r.webhooks = append(r.webhooks, webhook)
+	return nil
+}
+
+func (r *webhookRepoStub) GetByID(_ context.Context, id string) (*model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, webhook := range r.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+	return nil, fmt.Errorf("webhook %s not found", id)
+}
+
+func (r *webhookRepoStub) List(context.Context) ([]*model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*model.Webhook(nil), r.webhooks...), nil
+}
+
+func (r *webhookRepoStub) ListByEvent(_ context.Context, eventType string) ([]*model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var webhooks []*model.Webhook
+	for _, webhook := range r.webhooks {
+		for _, e := range webhook.Events {
+			if webhook.Active && e == eventType {
+				webhooks = append(webhooks, webhook)
+			}
+		}
+	}
+	return webhooks, nil
+}
+
+func (r *webhookRepoStub) Delete(context.Context, string) error {
+	return nil
+}
+
+func (r *webhookRepoStub) CreateDelivery(_ context.Context, delivery *model.WebhookDelivery) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if delivery.ReplayOf == nil {
+		for _, existing := range r.deliveries {
+			if existing.ReplayOf == nil && existing.WebhookID == delivery.WebhookID && existing.EventID == delivery.EventID {
+				return false, nil
+			}
+		}
+	}
+	now := time.Now()
+	delivery.ID = fmt.Sprintf("delivery-%d", len(r.deliveries)+1)
+	delivery.NextAttemptAt = &now
+	r.deliveries = append(r.deliveries, delivery)
+	return true, nil
+}
+
+func (r *webhookRepoStub) GetDelivery(_ context.Context, webhookID, id string) (*model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		if delivery.ID == id && delivery.WebhookID == webhookID {
+			return delivery, nil
+		}
+	}
+	return nil, fmt.Errorf("delivery %s not found", id)
+}
+
+func (r *webhookRepoStub) ListDeliveries(_ context.Context, webhookID string) ([]*model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deliveries []*model.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepoStub) ClaimDueDeliveries(_ context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var deliveries []*model.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if len(deliveries) == limit {
+			break
+		}
+		if delivery.Status == model.DeliveryStatusPending && !delivery.NextAttemptAt.After(now) {
+			leased := now.Add(lease)
+			delivery.NextAttemptAt = &leased
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepoStub) UpdateDelivery(context.Context, *model.WebhookDelivery) error {
+	return nil
+}
+
+// receiver is a webhook endpoint answering with the given statuses in turn,
+// repeating the last one.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	status := rc.statuses[min(len(rc.requests), len(rc.statuses)-1)]
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	rc.mu.Unlock()
+
+	w.WriteHeader(status)
+}
+
+func newWebhookFixture(t *testing.T, statuses ...int) (*webhookRepoStub, *receiver, WebhookService, *DeliveryWorker) {
+	t.Helper()
+	return newWebhookFixtureAllowing(t, []string{"127.0.0.0/8", "::1/128"}, statuses...)
+}
+
+// newWebhookFixtureAllowing is newWebhookFixture with the receiver, which
+// listens on loopback, reachable only if allowedNetworks contains it.
+func newWebhookFixtureAllowing(t *testing.T, allowedNetworks []string, statuses ...int) (*webhookRepoStub, *receiver, WebhookService, *DeliveryWorker) {
+	t.Helper()
+
+	rc := &receiver{statuses: statuses}
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	repo := &webhookRepoStub{}
+	svc := NewWebhookService(repo)
+	_, err := svc.CreateWebhook(context.Background(), &model.CreateWebhookRequest{
+		URL:    server.URL,
+		Events: []string{model.EventSubscriptionCreated},
+		Secret: "0123456789abcdef0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	worker := NewDeliveryWorker(repo, config.WebhookConfig{
+		MaxAttempts:     5,
+		InitialBackoff:  10 * time.Second,
+		MaxBackoff:      time.Minute,
+		BatchSize:       10,
+		Timeout:         5 * time.Second,
+		AllowedNetworks: allowedNetworks,
+	})
+	return repo, rc, svc, worker
+}
+
+func publishCreated(t *testing.T, svc WebhookService, id string) {
+	t.Helper()
+	envelope := event.Envelope{ID: id, Type: model.EventSubscriptionCreated, TenantID: "default"}
+	if err := svc.Publish(context.Background(), envelope); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+}
+
+func TestSignPayload(t *testing.T) {
+	secret := "0123456789abcdef"
+	body := []byte(`{"id":"1"}`)
+	signature := SignPayload(secret, 1700000000, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		valid     bool
+	}{
+		{"same input", secret, 1700000000, body, true},
+		{"other secret", "fedcba9876543210", 1700000000, body, false},
+		{"other timestamp", secret, 1700000001, body, false},
+		{"tampered body", secret, 1700000000, []byte(`{"id":"2"}`), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SignPayload(tt.secret, tt.timestamp, tt.body)
+			if valid := hmac.Equal([]byte(got), []byte(signature)); valid != tt.valid {
+				t.Errorf("signature valid = %v, want %v", valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDeliveryWorkerSignsRequests(t *testing.T) {
+	repo, rc, svc, worker := newWebhookFixture(t, http.StatusOK)
+	publishCreated(t, svc, "event-1")
+
+	worker.processBatch(context.Background())
+
+	if len(rc.requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(rc.requests))
+	}
+	req, body := rc.requests[0], rc.bodies[0]
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderWebhookTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("bad %s header: %v", HeaderWebhookTimestamp, err)
+	}
+	want := SignPayload("0123456789abcdef0123456789abcdef", timestamp, body)
+	if got := req.Header.Get(HeaderWebhookSignature); got != want {
+		t.Errorf("%s = %q, want %q", HeaderWebhookSignature, got, want)
+	}
+	if got := req.Header.Get(HeaderWebhookEvent); got != model.EventSubscriptionCreated {
+		t.Errorf("%s = %q, want %q", HeaderWebhookEvent, got, model.EventSubscriptionCreated)
+	}
+	if got := req.Header.Get(HeaderWebhookID); got != repo.deliveries[0].ID {
+		t.Errorf("%s = %q, want %q", HeaderWebhookID, got, repo.deliveries[0].ID)
+	}
+	if status := repo.deliveries[0].Status; status != model.DeliveryStatusSucceeded {
+		t.Errorf("status = %q, want %q", status, model.DeliveryStatusSucceeded)
+	}
+}
+
+func TestDeliveryWorkerRetrySchedule(t *testing.T) {
+	repo, rc, svc, worker := newWebhookFixture(t, http.StatusInternalServerError)
+	publishCreated(t, svc, "event-1")
+	delivery := repo.deliveries[0]
+
+	tests := []struct {
+		attempt int
+		delay   time.Duration
+		status  string
+	}{
+		{1, 10 * time.Second, model.DeliveryStatusPending},
+		{2, 20 * time.Second, model.DeliveryStatusPending},
+		{3, 40 * time.Second, model.DeliveryStatusPending},
+		{4, time.Minute, model.DeliveryStatusPending},
+		{5, 0, model.DeliveryStatusFailed},
+	}
+	for _, tt := range tests {
+		before := time.Now()
+		worker.deliver(context.Background(), delivery)
+
+		if delivery.Attempts != tt.attempt {
+			t.Fatalf("attempts = %d, want %d", delivery.Attempts, tt.attempt)
+		}
+		if delivery.Status != tt.status {
+			t.Fatalf("attempt %d: status = %q, want %q", tt.attempt, delivery.Status, tt.status)
+		}
+		if delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusInternalServerError {
+			t.Errorf("attempt %d: response status = %v, want 500", tt.attempt, delivery.ResponseStatus)
+		}
+
+		if tt.status == model.DeliveryStatusFailed {
+			if delivery.NextAttemptAt != nil {
+				t.Errorf("attempt %d: next attempt scheduled after the last attempt", tt.attempt)
+			}
+			continue
+		}
+		if delivery.NextAttemptAt == nil {
+			t.Fatalf("attempt %d: no next attempt scheduled", tt.attempt)
+		}
+		if delay := delivery.NextAttemptAt.Sub(before); delay < tt.delay || delay > tt.delay+time.Second {
+			t.Errorf("attempt %d: next attempt in %v, want %v", tt.attempt, delay, tt.delay)
+		}
+	}
+
+	if len(rc.requests) != len(tests) {
+		t.Errorf("receiver got %d requests, want %d", len(rc.requests), len(tests))
+	}
+}
+
+func TestPublishEnqueuesEventOnce(t *testing.T) {
+	repo, _, svc, _ := newWebhookFixture(t, http.StatusOK)
+
+	// The outbox publishes again when another publisher failed.
+	publishCreated(t, svc, "event-1")
+	publishCreated(t, svc, "event-1")
+	publishCreated(t, svc, "event-2")
+
+	if len(repo.deliveries) != 2 {
+		t.Fatalf("got %d deliveries, want 2", len(repo.deliveries))
+	}
+}
+
+func TestReplayDelivery(t *testing.T) {
+	repo, rc, svc, worker := newWebhookFixture(t, http.StatusOK)
+	publishCreated(t, svc, "event-1")
+	worker.processBatch(context.Background())
+
+	original := repo.deliveries[0]
+	replayed, err := svc.ReplayDelivery(context.Background(), original.WebhookID, original.ID)
+	if err != nil {
+		t.Fatalf("ReplayDelivery: %v", err)
+	}
+	if replayed.ID == original.ID {
+		t.Fatal("replay reused the original delivery")
+	}
+	if replayed.ReplayOf == nil || *replayed.ReplayOf != original.ID {
+		t.Errorf("replay_of = %v, want %q", replayed.ReplayOf, original.ID)
+	}
+
+	worker.processBatch(context.Background())
+
+	if len(rc.requests) != 2 {
+		t.Fatalf("receiver got %d requests, want 2", len(rc.requests))
+	}
+	if string(rc.bodies[0]) != string(rc.bodies[1]) {
+		t.Errorf("replayed body %s differs from original %s", rc.bodies[1], rc.bodies[0])
+	}
+	if got := rc.requests[1].Header.Get(HeaderWebhookID); got != replayed.ID {
+		t.Errorf("%s = %q, want %q", HeaderWebhookID, got, replayed.ID)
+	}
+	if original.Status != model.DeliveryStatusSucceeded || replayed.Status != model.DeliveryStatusSucceeded {
+		t.Errorf("statuses = %q, %q, want both succeeded", original.Status, replayed.Status)
+	}
+}
+
+func TestCheckReceiverAddress(t *testing.T) {
+	allowed := []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}
+
+	tests := []struct {
+		address string
+		ok      bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1::]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.0.0.5:80", false},
+		{"172.16.3.4:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:80", false},
+		{"[fd00:ec2::254]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"0.0.0.0:80", false},
+		{"10.1.2.3:80", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := checkReceiverAddress(tt.address, allowed)
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("checkReceiverAddress(%q) = %v, want allowed %v", tt.address, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDeliveryWorkerRefusesInternalReceivers(t *testing.T) {
+	repo, rc, svc, worker := newWebhookFixtureAllowing(t, nil, http.StatusOK)
+	publishCreated(t, svc, "event-1")
+
+	worker.processBatch(context.Background())
+
+	if len(rc.requests) != 0 {
+		t.Fatalf("loopback receiver got %d requests, want none", len(rc.requests))
+	}
+	delivery := repo.deliveries[0]
+	if delivery.Status == model.DeliveryStatusSucceeded || delivery.LastError == nil {
+		t.Errorf("delivery = %+v, want a failed attempt", delivery)
+	}
+}
@@ -0,0 +1,58 @@
+package tenant
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/problem"
+)
+
+// Middleware resolves the tenant of the request. A tenant bound to the
+// token or API key always wins and the X-Tenant-ID header may only repeat
+// it. The header can select a tenant only for admins without a tenant
+// binding and when authentication is disabled.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(Header)
+		if header != "" && !ValidID(header) {
+			problem.Abort(c, problem.New(http.StatusBadRequest, "invalid_tenant_id", "invalid "+Header))
+			return
+		}
+
+		id := DefaultID
+		principal, authenticated := auth.PrincipalFromContext(c.Request.Context())
+
+		switch {
+		case authenticated && principal.TenantID != "":
+			if header != "" && header != principal.TenantID {
+				problem.Abort(c, problem.New(http.StatusForbidden, "tenant_mismatch", "tenant mismatch"))
+				return
+			}
+			id = principal.TenantID
+		case header != "" && (!authenticated || principal.Admin):
+			id = header
+		case header != "" && header != DefaultID:
+			problem.Abort(c, problem.New(http.StatusForbidden, "tenant_not_allowed", "tenant not allowed"))
+			return
+		}
+
+		c.Request = c.Request.WithContext(WithID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// ClientKey identifies the client of a request by API key, then by
+// authenticated user, then by IP address. It has to run after Middleware for
+// users to be told apart by tenant.
+func ClientKey(c *gin.Context) string {
+	if principal, ok := auth.PrincipalFromContext(c.Request.Context()); ok {
+		if principal.IsAPIKey() {
+			return "key:" + principal.APIKeyID
+		}
+		if principal.Subject != "" {
+			return "user:" + FromContext(c.Request.Context()) + ":" + principal.Subject
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
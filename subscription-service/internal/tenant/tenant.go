@@ -0,0 +1,35 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+const (
+	// DefaultID is the tenant of rows created before multi-tenancy and of
+	// callers that are not bound to a tenant.
+	DefaultID = "default"
+
+	Header = "X-Tenant-ID"
+)
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+type tenantKey struct{}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant of the request, background jobs and CLI
+// commands without an explicit tenant work on DefaultID.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(tenantKey{}).(string); ok && id != "" {
+		return id
+	}
+	return DefaultID
+}
@@ -0,0 +1,148 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"subscription-service/internal/apperror"
+	"subscription-service/internal/model"
+)
+
+// Register adds the custom tags to the validator used by Gin binding:
+//
+//	month            a date in any format accepted by model.ParseMonth
+//	notbefore=Field  a month not before the month in the sibling Field
+//
+// and makes errors refer to fields by their JSON or query name. It has to
+// be called before the first request is bound.
+func Register() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return fmt.Errorf("unexpected validator engine %T", binding.Validator.Engine())
+	}
+
+	v.RegisterTagNameFunc(fieldName)
+	if err := v.RegisterValidation("month", validMonth); err != nil {
+		return err
+	}
+	return v.RegisterValidation("notbefore", notBefore)
+}
+
+// Fields turns a binding error into field errors. It reports false for
+// errors that are not about particular fields, such as malformed JSON.
+func Fields(err error) ([]apperror.FieldError, bool) {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]apperror.FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			code, message := describe(fe)
+			fields = append(fields, apperror.FieldError{Field: fe.Field(), Code: code, Message: message})
+		}
+		return fields, true
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []apperror.FieldError{{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: "must be of type " + typeErr.Type.String(),
+		}}, true
+	}
+
+	return nil, false
+}
+
+func describe(fe validator.FieldError) (string, string) {
+	switch fe.Tag() {
+	case "required":
+		return "required", "is required"
+	case "uuid":
+		return "invalid_uuid", "must be a valid UUID"
+	case "month":
+		return "invalid_date", "must be a date in YYYY-MM, YYYY-MM-DD, MM-YYYY or DD-MM-YYYY format"
+	case "notbefore":
+		return "end_before_start", "must not be before " + snakeCase(fe.Param())
+	case "email":
+		return "invalid_email", "must be a valid email address"
+	case "url":
+		return "invalid_url", "must be a valid URL"
+	case "oneof":
+		return "invalid_value", "must be one of " + fe.Param()
+	case "max":
+		return "too_large", "must be at most " + fe.Param() + unit(fe)
+	case "min":
+		return "too_small", "must be at least " + fe.Param() + unit(fe)
+	}
+	return fe.Tag(), "failed the " + fe.Tag() + " check"
+}
+
+func unit(fe validator.FieldError) string {
+	switch fe.Kind() {
+	case reflect.String:
+		return " characters long"
+	case reflect.Slice, reflect.Map:
+		return " items"
+	}
+	return ""
+}
+
+// snakeCase turns the Go name of a sibling field into its JSON name, the
+// models follow that convention.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func fieldName(f reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(f.Tag.Get(key), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func validMonth(fl validator.FieldLevel) bool {
+	_, err := model.ParseMonth(fl.Field().String())
+	return err == nil
+}
+
+// notBefore compares with the sibling field only if it is set, partial
+// updates are checked against the stored value by the service.
+func notBefore(fl validator.FieldLevel) bool {
+	other, kind, _, ok := fl.GetStructFieldOKAdvanced2(fl.Parent(), fl.Param())
+	if !ok || kind != reflect.String {
+		return true
+	}
+
+	start, err := model.ParseMonth(other.String())
+	if err != nil {
+		// Reported by the month tag of the sibling.
+		return true
+	}
+	end, err := model.ParseMonth(fl.Field().String())
+	if err != nil {
+		return true
+	}
+	return !end.Before(start)
+}
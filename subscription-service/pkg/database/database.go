@@ -1,50 +1,138 @@
 package database
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"math/rand/v2"
+	"net/url"
+	"regexp"
+	"strconv"
 	"subscription-service/internal/config"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
-func Connect(dbConfig config.DatabaseConfig) (*sqlx.DB, error) {
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		dbConfig.Host, dbConfig.Port, dbConfig.User, dbConfig.Password, dbConfig.Name, dbConfig.SSLMode)
+// DSN is the lib/pq connection string of dbConfig. lib/pq passes unknown
+// keys such as statement_timeout to the server as session settings. The
+// timeout is always set, so that zero disables it whatever the server default.
+func DSN(dbConfig config.DatabaseConfig) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s statement_timeout=%d",
+		dbConfig.Host, dbConfig.Port, dbConfig.User, dbConfig.Password, dbConfig.Name, dbConfig.SSLMode,
+		dbConfig.StatementTimeout.Milliseconds())
+}
+
+// replicaStatementTimeout matches a statement_timeout key in a key=value
+// connection string.
+var replicaStatementTimeout = regexp.MustCompile(`(^|\s)statement_timeout\s*=`)
+
+// replicaDSN adds the session settings of DSN to dsn, the connection string
+// of a replica in key=value or URL form, unless it sets them itself.
+func replicaDSN(dsn string, dbConfig config.DatabaseConfig) string {
+	timeout := strconv.FormatInt(dbConfig.StatementTimeout.Milliseconds(), 10)
+
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		query := u.Query()
+		if !query.Has("statement_timeout") {
+			query.Set("statement_timeout", timeout)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
 
-	db, err := sqlx.Connect("postgres", connStr)
+	if replicaStatementTimeout.MatchString(dsn) {
+		return dsn
+	}
+	return dsn + " statement_timeout=" + timeout
+}
+
+// Connect opens the pool of the primary and waits for the database to come
+// up, retrying with exponential backoff and jitter for up to
+// dbConfig.ConnectTimeout.
+func Connect(dbConfig config.DatabaseConfig) (*sqlx.DB, error) {
+	db, err := sqlx.Open("postgres", DSN(dbConfig))
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
+	configurePool(db, dbConfig)
+
+	deadline := time.Now().Add(dbConfig.ConnectTimeout)
+	for attempt := 1; ; attempt++ {
+		err := db.Ping()
+		if err == nil {
+			break
+		}
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("error pinging database: %w", err)
+		wait := connectBackoff(dbConfig.ConnectInitialBackoff, dbConfig.ConnectMaxBackoff, attempt)
+		if time.Now().Add(wait).After(deadline) {
+			db.Close()
+			return nil, fmt.Errorf("error pinging database after %d attempts: %w", attempt, err)
+		}
+		slog.Warn("database is not available yet, retrying", "attempt", attempt, "retry_in", wait, "error", err)
+		time.Sleep(wait)
 	}
 
-	log.Println("Successfully connected to database")
+	slog.Info("connected to database", "host", dbConfig.Host, "database", dbConfig.Name)
 	return db, nil
 }
 
-func Migrate(db *sqlx.DB) error {
-	migrationSQL, err := os.ReadFile("internal/migration/001_init.sql")
-	if err != nil {
-		return fmt.Errorf("error reading migration file: %w", err)
-	}
+func configurePool(db *sqlx.DB, dbConfig config.DatabaseConfig) {
+	db.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	db.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	db.SetConnMaxLifetime(dbConfig.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(dbConfig.ConnMaxIdleTime)
+}
 
-	_, err = db.Exec(string(migrationSQL))
-	if err != nil {
-		return fmt.Errorf("error executing migration: %w", err)
+// connectBackoff doubles initial for every failed attempt up to max and picks
+// a random delay in its upper half, so that replicas restarted together do
+// not retry in lockstep.
+func connectBackoff(initial, max time.Duration, attempt int) time.Duration {
+	delay := initial
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
 	}
+	if delay <= 1 {
+		return delay
+	}
+	return delay/2 + rand.N(delay/2)
+}
+
+// MonitorPool logs whenever requests had to wait for a free connection of db
+// since the previous check, until ctx is done. Waiting means the pool is
+// exhausted: max_open_conns is too low or connections are held too long.
+func MonitorPool(ctx context.Context, db *sqlx.DB, name string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	log.Println("Database migrations applied successfully")
-	return nil
+	last := db.Stats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := db.Stats()
+		if waits := stats.WaitCount - last.WaitCount; waits > 0 {
+			slog.Warn("database connection pool exhausted",
+				"pool", name,
+				"waits", waits,
+				"wait_ms", (stats.WaitDuration - last.WaitDuration).Milliseconds(),
+				"in_use", stats.InUse,
+				"max_open", stats.MaxOpenConnections)
+		}
+		last = stats
+	}
 }
 
 func Close(db *sqlx.DB) {
 	if db != nil {
 		db.Close()
-		log.Println("Database connection closed")
+		slog.Info("database connection closed")
 	}
 }
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"subscription-service/internal/config"
+)
+
+// listenPingInterval is how often an idle listener checks its connection.
+const listenPingInterval = time.Minute
+
+// Listen passes the payload of every notification on channel to notify until
+// ctx is done. Notifications sent while the connection is down are lost, so
+// reset is called after every reconnect for the caller to drop whatever the
+// notifications keep in sync.
+func Listen(ctx context.Context, dbConfig config.DatabaseConfig, channel string, notify func(payload string), reset func()) error {
+	listener := pq.NewListener(DSN(dbConfig), time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("database listener connection error", "channel", channel, "error", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(channel); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+	slog.Info("listening for database notifications", "channel", channel)
+
+	ticker := time.NewTicker(listenPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification follows a reconnect.
+			if n == nil {
+				reset()
+				continue
+			}
+			notify(n.Extra)
+		case <-ticker.C:
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"subscription-service/internal/config"
+)
+
+// replicaCheckTimeout bounds a single health check of a replica.
+const replicaCheckTimeout = 2 * time.Second
+
+type primaryKey struct{}
+
+// WithPrimary makes the reads in ctx go to the primary, for requests that
+// have to see their own or a client's recent writes.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+type replica struct {
+	index   int
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// Router sends reads to the healthy replicas in turn and falls back to the
+// primary when there are none. Writes always use the primary.
+type Router struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+// NewRouter opens the replicas of dbConfig next to primary, with the session
+// settings of the primary, and checks them once, Run keeps checking. A
+// replica that is down is skipped, not an error.
+func NewRouter(primary *sqlx.DB, dbConfig config.DatabaseConfig) (*Router, error) {
+	router := &Router{primary: primary}
+	for i, dsn := range dbConfig.Replicas {
+		db, err := sqlx.Open("postgres", replicaDSN(dsn, dbConfig))
+		if err != nil {
+			router.Close()
+			return nil, err
+		}
+		configurePool(db, dbConfig)
+		router.replicas = append(router.replicas, &replica{index: i, db: db})
+	}
+
+	router.check(context.Background())
+	return router, nil
+}
+
+func (r *Router) Primary() *sqlx.DB {
+	return r.primary
+}
+
+// Reader returns the database to read from in ctx.
+func (r *Router) Reader(ctx context.Context) *sqlx.DB {
+	if len(r.replicas) == 0 || usePrimary(ctx) {
+		return r.primary
+	}
+
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		replica := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if replica.healthy.Load() {
+			return replica.db
+		}
+	}
+	return r.primary
+}
+
+// Run checks the replicas every interval until ctx is done.
+func (r *Router) Run(ctx context.Context, interval time.Duration) {
+	if len(r.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check(ctx)
+		}
+	}
+}
+
+// MonitorPools runs MonitorPool for the primary and every replica until ctx
+// is done.
+func (r *Router) MonitorPools(ctx context.Context, interval time.Duration) {
+	var wg sync.WaitGroup
+	wg.Add(1 + len(r.replicas))
+	go func() {
+		defer wg.Done()
+		MonitorPool(ctx, r.primary, "primary", interval)
+	}()
+	for _, replica := range r.replicas {
+		go func() {
+			defer wg.Done()
+			MonitorPool(ctx, replica.db, fmt.Sprintf("replica-%d", replica.index), interval)
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *Router) check(ctx context.Context) {
+	for _, replica := range r.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+		err := replica.db.PingContext(checkCtx)
+		cancel()
+
+		healthy := err == nil
+		if replica.healthy.Swap(healthy) == healthy {
+			continue
+		}
+		if healthy {
+			slog.Info("database replica is up", "replica", replica.index)
+		} else {
+			slog.Warn("database replica is down, reading from the others or the primary", "replica", replica.index, "error", err)
+		}
+	}
+}
+
+// Close closes the replicas, the primary is closed by its owner.
+func (r *Router) Close() {
+	for _, replica := range r.replicas {
+		replica.db.Close()
+	}
+}